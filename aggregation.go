@@ -0,0 +1,112 @@
+package ts
+
+import "sort"
+
+// DefaultFacetSize is the number of buckets a TermsAggregation returns when
+// its Size is not set.
+const DefaultFacetSize = 10
+
+// Aggregation summarizes the documents matched by a search.
+type Aggregation interface {
+	// Name is the key that the result of the aggregation is returned under.
+	Name() string
+	aggregate(ix *Index, results []*QueryResult) *AggregationResult
+}
+
+// AggregationResult is the result of an Aggregation.
+type AggregationResult struct {
+	Buckets []Bucket
+	// Other is the number of values counted in buckets that were not
+	// returned because of the size limit.
+	Other int
+	// Missing is the number of matched documents without a value.
+	Missing int
+}
+
+// Bucket is the number of matched documents with a value.
+type Bucket struct {
+	Value string
+	Count int
+}
+
+// Aggregations holds the results of a search's aggregations keyed by name.
+type Aggregations map[string]*AggregationResult
+
+// TermsAggregation counts the matched documents for each value of a keyword
+// field. Buckets are ordered by count, most frequent first, and then by value.
+type TermsAggregation struct {
+	Field string
+	// Size is the maximum number of buckets returned. Defaults to
+	// DefaultFacetSize.
+	Size int
+	// MinCount is the number of documents a value needs to be returned.
+	// Defaults to 1.
+	MinCount int
+}
+
+// TermsFacet creates a TermsAggregation over a keyword field that returns
+// the top size values.
+func TermsFacet(field string, size int) *TermsAggregation {
+	return &TermsAggregation{Field: field, Size: size}
+}
+
+// Name returns the name of the aggregated field.
+func (ta *TermsAggregation) Name() string { return ta.Field }
+
+func (ta *TermsAggregation) aggregate(ix *Index, results []*QueryResult) *AggregationResult {
+	res := &AggregationResult{}
+	col, ok := ix.keywords[ta.Field]
+	if !ok {
+		res.Missing = len(results)
+		return res
+	}
+	counts := make([]int, len(col.values))
+	for _, r := range results {
+		ords := col.get(r.DocumentID)
+		if len(ords) == 0 {
+			res.Missing++
+		}
+		for _, ord := range ords {
+			counts[ord]++
+		}
+	}
+	minCount := atLeast(ta.MinCount, 1)
+	for ord, n := range counts {
+		if n >= minCount {
+			res.Buckets = append(res.Buckets, Bucket{Value: col.values[ord], Count: n})
+		}
+	}
+	sort.Slice(res.Buckets, func(i, j int) bool {
+		a, b := res.Buckets[i], res.Buckets[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Value < b.Value
+	})
+	size := ta.Size
+	if size <= 0 {
+		size = DefaultFacetSize
+	}
+	if len(res.Buckets) > size {
+		for _, b := range res.Buckets[size:] {
+			res.Other += b.Count
+		}
+		res.Buckets = res.Buckets[:size]
+	}
+	return res
+}
+
+// SearchAggregate runs a search and computes aggregations over every
+// document it matched.
+func (ix *Index) SearchAggregate(query Query, aggs []Aggregation, opts ...SearchOption) ([]*QueryResult, Aggregations) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	results := ix.search(query, newSearchOptions(opts))
+	out := make(Aggregations, len(aggs))
+	for _, a := range aggs {
+		out[a.Name()] = a.aggregate(ix, results)
+	}
+	return results, out
+}
+
+var _ Aggregation = (*TermsAggregation)(nil)
@@ -0,0 +1,58 @@
+package ts
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestTermsAggregation(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	for _, doc := range []*Document{
+		NewDocument("raft", TextField(DefaultField, "consensus algorithm"),
+			KeywordField("category", "papers"), KeywordField("tag", "consensus"), KeywordField("tag", "logs")),
+		NewDocument("paxos", TextField(DefaultField, "consensus made simple"),
+			KeywordField("category", "papers"), KeywordField("tag", "consensus"), KeywordField("tag", "consensus")),
+		NewDocument("ode", TextField(DefaultField, "an ode to consensus"),
+			KeywordField("category", "poems")),
+		NewDocument("gfs", TextField(DefaultField, "a distributed file system"),
+			KeywordField("category", "papers"), KeywordField("tag", "storage")),
+		NewDocument("notes", TextField(DefaultField, "consensus notes")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+
+	res, aggs := ix.SearchAggregate(StringQuery("consensus"), []Aggregation{
+		TermsFacet("category", 0),
+		TermsFacet("tag", 1),
+		TermsFacet("missing", 0),
+	})
+	is.Equal(len(res), 4)
+	is.Equal(aggs["category"], &AggregationResult{
+		Buckets: []Bucket{{"papers", 2}, {"poems", 1}},
+		Missing: 1,
+	})
+	is.Equal(aggs["tag"], &AggregationResult{
+		Buckets: []Bucket{{"consensus", 2}},
+		Other:   1,
+		Missing: 2,
+	})
+	is.Equal(aggs["missing"], &AggregationResult{Missing: 4})
+
+	_, aggs = ix.SearchAggregate(StringQuery("consensus"), []Aggregation{
+		&TermsAggregation{Field: "category", MinCount: 2},
+	})
+	is.Equal(aggs["category"].Buckets, []Bucket{{"papers", 2}})
+
+	// Deleted documents are not counted.
+	is.NoErr(ix.Delete(ix.names["raft"]))
+	_, aggs = ix.SearchAggregate(StringQuery("consensus"), []Aggregation{TermsFacet("category", 0)})
+	is.Equal(aggs["category"].Buckets, []Bucket{{"papers", 1}, {"poems", 1}})
+
+	res = ix.Search(KeywordQuery("category", "papers"))
+	is.Equal(len(res), 2)
+	is.Equal(len(ix.Search(KeywordQuery("tag", "Consensus"))), 0)
+}
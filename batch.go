@@ -0,0 +1,73 @@
+package ts
+
+import "io"
+
+// Batch is a group of documents that are analyzed ahead of time and added to
+// an Index all at once with Index.Apply.
+type Batch struct {
+	ix   *Index
+	docs []*parsedDoc
+}
+
+// NewBatch creates a Batch that analyzes documents with the index's
+// analyzers.
+func (ix *Index) NewBatch() *Batch {
+	return &Batch{ix: ix}
+}
+
+// Add will analyze a stream of text and queue it to be added to the index
+// as the DefaultField of a document.
+func (b *Batch) Add(name string, r io.Reader) error {
+	doc, err := b.ix.parseText(name, r)
+	if err != nil {
+		return err
+	}
+	b.docs = append(b.docs, doc)
+	return nil
+}
+
+// AddDocument will analyze a document and queue it to be added to the index.
+func (b *Batch) AddDocument(d *Document) error {
+	doc, err := b.ix.parseDoc(d)
+	if err != nil {
+		return err
+	}
+	b.docs = append(b.docs, doc)
+	return nil
+}
+
+// Len returns the number of documents in the batch.
+func (b *Batch) Len() int { return len(b.docs) }
+
+// Reset removes all documents from the batch so it can be reused.
+func (b *Batch) Reset() {
+	for i := range b.docs {
+		b.docs[i] = nil
+	}
+	b.docs = b.docs[:0]
+}
+
+// Apply adds every document in the batch to the index and returns their IDs
+// in the order they were added to the batch. Searches will either see all of
+// the documents in the batch or none of them. Documents are written to the
+// index's Store before any of them is indexed, so if the store fails the
+// documents that were written are removed and none of the batch is added.
+func (ix *Index) Apply(b *Batch) ([]DocID, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	first := DocID(len(ix.docNames))
+	for i, doc := range b.docs {
+		if err := ix.storeDoc(first+DocID(i), doc); err != nil {
+			for j := 0; j <= i; j++ {
+				ix.unstoreDoc(first + DocID(j))
+			}
+			return nil, err
+		}
+	}
+	ids := make([]DocID, len(b.docs))
+	for i, doc := range b.docs {
+		ids[i] = first + DocID(i)
+		ix.index(ids[i], doc)
+	}
+	return ids, nil
+}
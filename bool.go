@@ -0,0 +1,299 @@
+package ts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// BoolQuery combines queries with the semantics of Lucene's BooleanQuery and
+// Elasticsearch's bool query.
+//
+// A document has to match every Must and Filter clause and no MustNot
+// clause. Should clauses are optional when there are Must or Filter clauses
+// but add to the score of the documents they match, otherwise at least one
+// of them has to match. A query with only MustNot clauses matches every
+// document that they do not match.
+type BoolQuery struct {
+	// Must clauses have to match and add to the score.
+	Must []Query
+	// Should clauses add to the score of the documents they match.
+	Should []Query
+	// MustNot clauses exclude the documents they match.
+	MustNot []Query
+	// Filter clauses have to match but do not change the score.
+	Filter []Query
+	// MinimumShouldMatch is the number of Should clauses that a document has
+	// to match. A negative value is the number of Should clauses that may be
+	// missed. When it is zero one Should clause has to match if there are no
+	// Must or Filter clauses.
+	MinimumShouldMatch int
+}
+
+// Not matches every document that does not match a query. When used in And
+// or as a required clause the documents matching the query are subtracted
+// from the other clauses' matches.
+func Not(q Query) Query {
+	return &BoolQuery{MustNot: []Query{q}}
+}
+
+// exclusions returns the queries of a query that only excludes documents.
+func exclusions(q Query) ([]Query, bool) {
+	bq, ok := q.(*BoolQuery)
+	if !ok || len(bq.MustNot) == 0 || len(bq.Must)+len(bq.Should)+len(bq.Filter) > 0 {
+		return nil, false
+	}
+	return bq.MustNot, true
+}
+
+func (bq *BoolQuery) Keys() []string {
+	keys := make([]string, 0)
+	for _, q := range bq.Must {
+		keys = append(keys, q.Keys()...)
+	}
+	for _, q := range bq.Should {
+		keys = append(keys, q.Keys()...)
+	}
+	return keys
+}
+
+// String returns the query with the clauses prefixed by + for Must, # for
+// Filter and - for MustNot. MinimumShouldMatch is written as ~N after the
+// clauses.
+func (bq *BoolQuery) String() string {
+	parts := make([]string, 0, len(bq.Must)+len(bq.Filter)+len(bq.Should)+len(bq.MustNot))
+	for _, q := range bq.Must {
+		parts = append(parts, "+"+q.String())
+	}
+	for _, q := range bq.Filter {
+		parts = append(parts, "#"+q.String())
+	}
+	for _, q := range bq.Should {
+		parts = append(parts, q.String())
+	}
+	for _, q := range bq.MustNot {
+		parts = append(parts, "-"+q.String())
+	}
+	s := "(" + strings.Join(parts, " ") + ")"
+	if bq.MinimumShouldMatch != 0 {
+		s += "~" + strconv.Itoa(bq.MinimumShouldMatch)
+	}
+	return s
+}
+
+// minShould returns the number of should clauses that a document has to
+// match.
+func (bq *BoolQuery) minShould(required bool) int {
+	n := bq.MinimumShouldMatch
+	if n < 0 {
+		n = atLeast(len(bq.Should)+n, 0)
+	}
+	if n == 0 && !required && len(bq.Should) > 0 {
+		n = 1
+	}
+	return n
+}
+
+func (bq *BoolQuery) search(ix *Index) []*posting {
+	var (
+		scored, filters, excluded [][]*posting
+		required                  = len(bq.Must)+len(bq.Filter) > 0
+	)
+	for _, q := range bq.MustNot {
+		if p := q.search(ix); len(p) > 0 {
+			excluded = append(excluded, p)
+		}
+	}
+	for i, clauses := range [][]Query{bq.Must, bq.Filter} {
+		for _, q := range clauses {
+			// A required negation is the same as excluding its queries.
+			if qs, ok := exclusions(q); ok {
+				excluded = appendResults(excluded, ix, qs)
+				continue
+			}
+			p := q.search(ix)
+			if len(p) == 0 {
+				return nil
+			}
+			if i == 0 {
+				scored = append(scored, p)
+			} else {
+				filters = append(filters, p)
+			}
+		}
+	}
+	should := make([][]*posting, len(bq.Should))
+	for i, q := range bq.Should {
+		should[i] = q.search(ix)
+	}
+
+	var res []*posting
+	need := bq.minShould(required)
+	switch {
+	case len(scored) > 0:
+		res = kIntersect(scored)
+	case len(filters) > 0:
+		res = unscored(filters[0])
+		filters = filters[1:]
+	case need > 0:
+		res = matchShould(should, need)
+		should = nil
+	default:
+		// Only negations are required, so every other document matches and
+		// the Should clauses still score them.
+		res = ix.complement(union(excluded))
+		excluded = nil
+	}
+	for _, f := range filters {
+		res = intersectWith(res, f)
+	}
+	if len(should) > 0 {
+		if need > 0 {
+			res = intersectWith(res, matchShould(should, need))
+		}
+		res = addOptional(res, union(nonEmpty(should)))
+	}
+	if len(excluded) > 0 {
+		res = difference(res, union(excluded))
+	}
+	return res
+}
+
+// matchShould returns the documents found in at least need of the lists. The
+// positions of every list that a document is in are combined.
+func matchShould(lists [][]*posting, need int) []*posting {
+	if need > len(lists) {
+		return nil
+	}
+	var (
+		res   []*posting
+		iters = make([]int, len(lists))
+	)
+	for {
+		// Find the smallest current document ID.
+		var (
+			id    DocID
+			found bool
+		)
+		for i, l := range lists {
+			if iters[i] < len(l) && (!found || l[iters[i]].ID < id) {
+				id, found = l[iters[i]].ID, true
+			}
+		}
+		if !found {
+			return res
+		}
+		var matched []*posting
+		for i, l := range lists {
+			if iters[i] < len(l) && l[iters[i]].ID == id {
+				matched = append(matched, l[iters[i]])
+				iters[i]++
+			}
+		}
+		if len(matched) < need {
+			continue
+		}
+		p := &posting{ID: id, hits: combineHits(matched...)}
+		for _, m := range matched {
+			p.Pos = append(p.Pos, m.Pos...)
+		}
+		res = append(res, p)
+	}
+}
+
+// intersectWith returns the postings of a that are also in b without
+// adding the positions of b.
+func intersectWith(a, b []*posting) []*posting {
+	res := make([]*posting, 0, len(a))
+	j := 0
+	for _, p := range a {
+		if j = seek(b, j, p.ID); j < len(b) && b[j].ID == p.ID {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// unscored returns postings without positions so that the documents match
+// without a score.
+func unscored(postings []*posting) []*posting {
+	res := make([]*posting, len(postings))
+	for i, p := range postings {
+		res[i] = &posting{ID: p.ID}
+	}
+	return res
+}
+
+func nonEmpty(lists [][]*posting) [][]*posting {
+	res := make([][]*posting, 0, len(lists))
+	for _, l := range lists {
+		if len(l) > 0 {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// appendResults appends the non-empty results of queries to lists.
+func appendResults(lists [][]*posting, ix *Index, queries []Query) [][]*posting {
+	for _, q := range queries {
+		if p := q.search(ix); len(p) > 0 {
+			lists = append(lists, p)
+		}
+	}
+	return lists
+}
+
+// addOptional adds the positions of the optional postings to the required
+// postings of the same document. Documents that are only in optional are
+// left out.
+func addOptional(required, optional []*posting) []*posting {
+	res := make([]*posting, len(required))
+	j := 0
+	for i, p := range required {
+		j = seek(optional, j, p.ID)
+		if j >= len(optional) || optional[j].ID != p.ID {
+			res[i] = p
+			continue
+		}
+		o := optional[j]
+		pos := make([]uint, 0, len(p.Pos)+len(o.Pos))
+		res[i] = &posting{
+			ID:   p.ID,
+			Pos:  append(append(pos, p.Pos...), o.Pos...),
+			hits: combineHits(p, o),
+		}
+	}
+	return res
+}
+
+// difference returns the postings in a that are not in b. Both lists are
+// sorted by document ID so b is skipped through with seek rather than read
+// in full.
+func difference(a, b []*posting) []*posting {
+	res := make([]*posting, 0, len(a))
+	j := 0
+	for _, p := range a {
+		if j = seek(b, j, p.ID); j < len(b) && b[j].ID == p.ID {
+			continue
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// complement returns a posting without positions for every live document
+// that is not in postings.
+func (ix *Index) complement(postings []*posting) []*posting {
+	res := make([]*posting, 0, atLeast(int(ix.documents)-len(postings), 0))
+	j := 0
+	for id := DocID(0); id < DocID(len(ix.docNames)); id++ {
+		j = seek(postings, j, id)
+		if j < len(postings) && postings[j].ID == id || ix.isDeleted(id) {
+			continue
+		}
+		res = append(res, &posting{ID: id})
+	}
+	return res
+}
+
+var _ Query = (*BoolQuery)(nil)
@@ -0,0 +1,218 @@
+package ts
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestNot(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	for _, doc := range []*Document{
+		NewDocument("whitepaper", TextField(DefaultField, "bitcoin a peer to peer electronic cash system")),
+		NewDocument("ledger", TextField(DefaultField, "bitcoin and the blockchain ledger")),
+		NewDocument("chains", TextField(DefaultField, "blockchain beyond cryptocurrency")),
+		NewDocument("gfs", TextField(DefaultField, "the google file system")),
+		NewDocument("deleted", TextField(DefaultField, "deleted bitcoin notes")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	is.NoErr(ix.Delete(ix.names["deleted"]))
+	names := func(q Query) []string {
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		sort.Strings(res)
+		return res
+	}
+	is.Equal(names(And(StringQuery("bitcoin"), Not(StringQuery("blockchain")))), []string{"whitepaper"})
+	is.Equal(names(And(Not(StringQuery("blockchain")), StringQuery("bitcoin"))), []string{"whitepaper"})
+	is.Equal(names(Not(StringQuery("bitcoin"))), []string{"chains", "gfs"})
+	is.Equal(names(And(Not(StringQuery("bitcoin")), Not(StringQuery("google")))), []string{"chains"})
+	is.Equal(names(QueryTree(StringQuery("ledger"), Not(StringQuery("bitcoin")))), []string{"chains", "gfs", "ledger"})
+	is.Equal(names(Not(StringQuery("missing"))), []string{"chains", "gfs", "ledger", "whitepaper"})
+	is.Equal(names(And(StringQuery("bitcoin"), Not(Or("blockchain", "cash")))), []string{})
+	is.Equal(And(StringQuery("bitcoin"), Not(StringQuery("blockchain"))).String(), "(+bitcoin -blockchain)")
+	is.Equal(Not(StringQuery("blockchain")).String(), "(-blockchain)")
+}
+
+func TestDifferenceAndSeek(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	r := rand.New(rand.NewSource(1))
+	list := func(n int) []*posting {
+		ids := make(map[DocID]bool)
+		for len(ids) < n {
+			ids[DocID(r.Intn(1000))] = true
+		}
+		res := make([]*posting, 0, n)
+		for id := range ids {
+			res = append(res, &posting{ID: id})
+		}
+		sort.Sort(postingsList(res))
+		return res
+	}
+	for i := 0; i < 50; i++ {
+		a, b := list(r.Intn(100)), list(r.Intn(500))
+		inB := make(map[DocID]bool)
+		for _, p := range b {
+			inB[p.ID] = true
+		}
+		var want []DocID
+		for _, p := range a {
+			if !inB[p.ID] {
+				want = append(want, p.ID)
+			}
+		}
+		var got []DocID
+		for _, p := range difference(a, b) {
+			got = append(got, p.ID)
+		}
+		is.Equal(got, want)
+
+		for j := 0; j < 20; j++ {
+			start, id := r.Intn(len(b)+1), DocID(r.Intn(1100))
+			want := start
+			for want < len(b) && b[want].ID < id {
+				want++
+			}
+			is.Equal(seek(b, start, id), want)
+		}
+	}
+}
+
+func TestBoolQuery(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	for _, doc := range []*Document{
+		NewDocument("raft", TextField(DefaultField, "raft consensus leader election log replication"), KeywordField("kind", "paper")),
+		NewDocument("paxos", TextField(DefaultField, "paxos consensus made simple"), KeywordField("kind", "paper")),
+		NewDocument("zab", TextField(DefaultField, "zab atomic broadcast leader election"), KeywordField("kind", "paper")),
+		NewDocument("etcd", TextField(DefaultField, "etcd raft consensus log replication leader"), KeywordField("kind", "code")),
+		NewDocument("gfs", TextField(DefaultField, "google file system replication"), KeywordField("kind", "paper")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(q Query) []string {
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		sort.Strings(res)
+		return res
+	}
+	ranks := func(q Query) map[string]float64 {
+		res := make(map[string]float64)
+		for _, r := range ix.Search(q) {
+			res[r.DocumentName] = r.Rank
+		}
+		return res
+	}
+	terms := func(words ...string) []Query {
+		qs := make([]Query, len(words))
+		for i, w := range words {
+			qs[i] = StringQuery(w)
+		}
+		return qs
+	}
+
+	// Should clauses are optional next to a must clause but add to the score.
+	q := &BoolQuery{Must: terms("consensus"), Should: terms("leader")}
+	is.Equal(names(q), []string{"etcd", "paxos", "raft"})
+	r := ranks(q)
+	is.True(r["raft"] > r["paxos"])
+	is.True(r["etcd"] > r["paxos"])
+
+	// Without required clauses one should clause has to match.
+	is.Equal(names(&BoolQuery{Should: terms("paxos", "zab")}), []string{"paxos", "zab"})
+
+	// Filters are required but do not change the score.
+	filtered := &BoolQuery{Must: terms("consensus"), Filter: []Query{KeywordQuery("kind", "paper")}}
+	is.Equal(names(filtered), []string{"paxos", "raft"})
+	r, excluded := ranks(filtered), ranks(&BoolQuery{Must: terms("consensus"), MustNot: []Query{KeywordQuery("kind", "code")}})
+	is.Equal(r["raft"], excluded["raft"])
+	is.Equal(r["paxos"], excluded["paxos"])
+	for _, rank := range ranks(&BoolQuery{Filter: terms("replication")}) {
+		is.Equal(rank, 0.0)
+	}
+	is.Equal(names(&BoolQuery{Filter: terms("replication"), Should: terms("raft")}), []string{"etcd", "gfs", "raft"})
+
+	// MinimumShouldMatch counts the matching should clauses.
+	is.Equal(names(&BoolQuery{Should: terms("leader", "election", "log", "replication"), MinimumShouldMatch: 3}), []string{"etcd", "raft"})
+	is.Equal(names(&BoolQuery{Should: terms("election", "log", "replication"), MinimumShouldMatch: -1}), []string{"etcd", "raft"})
+	is.Equal(names(&BoolQuery{Must: terms("consensus"), Should: terms("leader", "election"), MinimumShouldMatch: 1}), []string{"etcd", "raft"})
+	is.Equal(names(&BoolQuery{Should: terms("leader"), MinimumShouldMatch: 2}), []string{})
+	is.Equal(names(&BoolQuery{Should: terms("missing", "leader"), MinimumShouldMatch: 2}), []string{})
+
+	// Must not clauses are subtracted.
+	is.Equal(names(&BoolQuery{Should: terms("leader", "google"), MustNot: terms("raft")}), []string{"gfs", "zab"})
+	is.Equal(names(&BoolQuery{Must: []Query{Not(StringQuery("consensus"))}, Filter: terms("replication")}), []string{"gfs"})
+	is.Equal(names(&BoolQuery{MustNot: terms("consensus", "google")}), []string{"zab"})
+
+	// Should clauses score the documents matched by required negations.
+	notPaxos := []Query{Not(StringQuery("paxos"))}
+	scoredOnly := ranks(&BoolQuery{Must: notPaxos, Should: terms("raft"), MinimumShouldMatch: 1})
+	is.True(scoredOnly["raft"] > 0)
+	is.True(scoredOnly["etcd"] > 0)
+	parsed, err := ParseQuery("+(-paxos) raft")
+	is.NoErr(err)
+	for _, q := range []Query{
+		&BoolQuery{Must: notPaxos, Should: terms("raft")},
+		&BoolQuery{Filter: notPaxos, Should: terms("raft")},
+		parsed,
+	} {
+		is.Equal(names(q), []string{"etcd", "gfs", "raft", "zab"})
+		r := ranks(q)
+		is.Equal(r["raft"], scoredOnly["raft"])
+		is.Equal(r["etcd"], scoredOnly["etcd"])
+		is.Equal(r["gfs"], 0.0)
+	}
+
+	q = &BoolQuery{
+		Must:               terms("consensus"),
+		Filter:             []Query{KeywordQuery("kind", "paper")},
+		Should:             terms("leader", "log"),
+		MustNot:            terms("paxos"),
+		MinimumShouldMatch: 1,
+	}
+	is.Equal(q.String(), "(+consensus #kind:paper leader log -paxos)~1")
+	is.Equal(q.Keys(), []string{"consensus", "leader", "log"})
+	parsed, err = ParseQuery(q.String())
+	is.NoErr(err)
+	is.Equal(parsed.String(), q.String())
+	is.Equal(names(parsed), []string{"raft"})
+}
+
+func TestMatchShould(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	list := func(ids ...DocID) []*posting {
+		res := make([]*posting, len(ids))
+		for i, id := range ids {
+			res[i] = &posting{ID: id, Pos: []uint{uint(i)}}
+		}
+		return res
+	}
+	lists := [][]*posting{list(1, 2, 5), list(2, 3, 5), list(5, 7), nil}
+	ids := func(ps []*posting) []DocID {
+		res := make([]DocID, 0, len(ps))
+		for _, p := range ps {
+			res = append(res, p.ID)
+		}
+		return res
+	}
+	is.Equal(ids(matchShould(lists, 1)), []DocID{1, 2, 3, 5, 7})
+	is.Equal(ids(matchShould(lists, 2)), []DocID{2, 5})
+	is.Equal(ids(matchShould(lists, 3)), []DocID{5})
+	is.Equal(ids(matchShould(lists, 4)), []DocID{})
+	is.Equal(ids(matchShould(lists, 5)), []DocID{})
+	is.Equal(len(matchShould(lists, 3)[0].Pos), 3)
+}
@@ -0,0 +1,42 @@
+package ts
+
+import "strconv"
+
+// Boost multiplies the score that a query's matches add to a document by
+// factor. A boosted clause of And, QueryTree or a BoolQuery counts for
+// more than the other clauses, so Boost(StringQuery("consensus"), 2) makes a
+// match on consensus worth twice a match on another term. Factors that are
+// not positive leave the query unboosted.
+func Boost(q Query, factor float64) Query {
+	if factor <= 0 {
+		return q
+	}
+	return &boostQuery{query: q, factor: factor}
+}
+
+type boostQuery struct {
+	query  Query
+	factor float64
+}
+
+func (bq *boostQuery) Keys() []string { return bq.query.Keys() }
+
+func (bq *boostQuery) String() string {
+	return bq.query.String() + "^" + strconv.FormatFloat(bq.factor, 'g', -1, 64)
+}
+
+func (bq *boostQuery) search(ix *Index) []*posting {
+	postings := bq.query.search(ix)
+	res := make([]*posting, len(postings))
+	for i, p := range postings {
+		hits := make([]hit, len(p.hits))
+		for j, h := range p.hits {
+			h.weight = h.boost() * bq.factor
+			hits[j] = h
+		}
+		res[i] = &posting{ID: p.ID, Pos: p.Pos, hits: hits}
+	}
+	return res
+}
+
+var _ Query = (*boostQuery)(nil)
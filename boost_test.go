@@ -0,0 +1,70 @@
+package ts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestBoost(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	// Every term is found once in two documents so with TFIDF each match
+	// scores the same and the ranks only differ by the boosts.
+	ix := NewIndex(WithScorer(TFIDF{}))
+	for _, doc := range []*Document{
+		NewDocument("raft", TextField(DefaultField, "raft consensus algorithm")),
+		NewDocument("tcp", TextField(DefaultField, "tcp transport protocol design")),
+		NewDocument("paxos", TextField(DefaultField, "paxos consensus protocol")),
+		NewDocument("gfs", TextField(DefaultField, "google file system")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	ranks := func(q Query) map[string]float64 {
+		res := make(map[string]float64)
+		for _, r := range ix.Search(q) {
+			res[r.DocumentName] = r.Rank
+		}
+		return res
+	}
+	order := func(q Query) []string {
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		return res
+	}
+
+	plain := ranks(QueryTree(StringQuery("consensus"), StringQuery("protocol")))
+	is.Equal(plain["raft"], plain["tcp"])
+	boosted := ranks(QueryTree(Boost(StringQuery("consensus"), 2), StringQuery("protocol")))
+	is.Equal(boosted["raft"], 2*plain["raft"])
+	is.Equal(boosted["tcp"], plain["tcp"])
+	// A document matching both clauses gets the weight of each match.
+	is.Equal(boosted["paxos"], 1.5*plain["paxos"])
+	is.Equal(order(QueryTree(StringQuery("consensus"), Boost(StringQuery("protocol"), 3))), []string{"paxos", "tcp", "raft"})
+
+	and := ranks(And(Boost(StringQuery("consensus"), 3), StringQuery("protocol")))
+	is.Equal(and["paxos"], 2*ranks(And(StringQuery("consensus"), StringQuery("protocol")))["paxos"])
+	is.Equal(ranks(Boost(Boost(StringQuery("raft"), 2), 1.5))["raft"], 3*ranks(StringQuery("raft"))["raft"])
+	is.Equal(Boost(StringQuery("raft"), 0), Query(StringQuery("raft")))
+
+	q := &BoolQuery{Should: []Query{Boost(StringQuery("consensus"), 2), StringQuery("protocol")}}
+	is.Equal(q.String(), "(consensus^2 protocol)")
+	is.Equal(q.Keys(), []string{"consensus", "protocol"})
+	is.Equal(ranks(q), boosted)
+
+	res := ix.Search(Boost(StringQuery("raft"), 2), Explain())
+	is.Equal(len(res), 1)
+	e := res[0].Explanation
+	is.True(e != nil)
+	is.Equal(e.Value, res[0].Rank)
+	is.Equal(len(e.Details), 1)
+	is.Equal(e.Details[0].Description, "weight(raft), product of:")
+	is.Equal(e.Details[0].Details[1].Value, 2.0)
+	is.Equal(e.Details[0].Details[1].Description, "boost")
+	is.True(strings.Contains(e.String(), "freq=1"))
+	is.True(ix.Search(StringQuery("raft"))[0].Explanation == nil)
+}
@@ -0,0 +1,325 @@
+package ts
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultField is the field that AddDocument and Upsert index text under.
+// Queries that do not name a field search the DefaultField.
+const DefaultField = "body"
+
+// Document is a document made up of named fields.
+type Document struct {
+	// Name is the external name of the document.
+	Name   string
+	Fields []Field
+}
+
+// NewDocument creates a document from a list of fields.
+func NewDocument(name string, fields ...Field) *Document {
+	return &Document{Name: name, Fields: fields}
+}
+
+// FieldType determines how a field is indexed.
+type FieldType uint8
+
+const (
+	// TextType fields are tokenized by an Analyzer.
+	TextType FieldType = iota
+	// NumericType fields hold a number that can be searched with a
+	// NumericRangeQuery.
+	NumericType
+	// DateType fields hold a time that can be searched with a
+	// DateRangeQuery.
+	DateType
+	// KeywordType fields are indexed as a single token without analysis
+	// and can be counted with a TermsAggregation.
+	KeywordType
+)
+
+// Field is a named section of a Document.
+type Field struct {
+	Name string
+	Type FieldType
+	// Value is the text of a field. Numeric and date fields are indexed and
+	// stored from Number and Time, and hold their value formatted as text
+	// when they are read back from the index.
+	Value  string
+	Number float64
+	Time   time.Time
+	// Analyzer overrides the analyzer that the index uses for this field.
+	Analyzer Analyzer
+	// Stored fields have their original value kept in the index's Store so
+	// that it can be returned with search results. All fields are indexed.
+	Stored bool
+}
+
+// TextField creates a field of text that will be analyzed.
+func TextField(name, value string) Field {
+	return Field{Name: name, Value: value}
+}
+
+// StoredField creates a field of text that will be analyzed and stored.
+func StoredField(name, value string) Field {
+	return Field{Name: name, Value: value, Stored: true}
+}
+
+// KeywordField creates a field whose whole value is a single term, such as a
+// category or tag. A document can hold several keyword fields with the same
+// name.
+func KeywordField(name, value string) Field {
+	return Field{Name: name, Type: KeywordType, Value: value}
+}
+
+// NumericField creates a field holding a number.
+func NumericField(name string, n float64) Field {
+	f := Field{Name: name, Type: NumericType, Number: n}
+	f.Value = f.formatValue()
+	return f
+}
+
+// DateField creates a field holding a time.
+func DateField(name string, t time.Time) Field {
+	f := Field{Name: name, Type: DateType, Time: t}
+	f.Value = f.formatValue()
+	return f
+}
+
+// formatValue returns the text of a field, which for numeric and date
+// fields is formatted from their typed value.
+func (f *Field) formatValue() string {
+	switch f.Type {
+	case NumericType:
+		return strconv.FormatFloat(f.Number, 'g', -1, 64)
+	case DateType:
+		return f.Time.Format(time.RFC3339Nano)
+	}
+	return f.Value
+}
+
+// parseValue sets the typed value of a field from the text written by
+// formatValue.
+func (f *Field) parseValue() (err error) {
+	switch f.Type {
+	case NumericType:
+		f.Number, err = strconv.ParseFloat(f.Value, 64)
+	case DateType:
+		f.Time, err = time.Parse(time.RFC3339Nano, f.Value)
+	}
+	return err
+}
+
+// Terms are stored in the index under a key made from the name of the field
+// they were found in and the token text.
+const fieldSep = "\x00"
+
+func fieldKey(field, token string) string {
+	return field + fieldSep + token
+}
+
+// splitFieldKey splits a term key into its field and token.
+func splitFieldKey(key string) (field, token string) {
+	i := strings.Index(key, fieldSep)
+	if i < 0 {
+		return "", key
+	}
+	return key[:i], key[i+len(fieldSep):]
+}
+
+// parsedDoc is a document that has been analyzed but not yet added to the
+// index.
+type parsedDoc struct {
+	name string
+	// Names of the document's fields
+	fields []string
+	// Positions of each term in the document keyed by field and token
+	terms map[string][]uint
+	// Frequency of the most frequent term in the document
+	maxFreq int
+	// Number of tokens in the document's text fields
+	length int
+	// Sum of the squared frequency of each term of the text fields
+	sumSquares int
+	// Compressed stored fields, nil if no fields are stored
+	stored []byte
+	// Values of keyword fields keyed by field name
+	keywords map[string][]string
+	// Sortable values of numeric and date fields keyed by field name
+	numbers map[string][]uint64
+	// Position that the next value of a text field starts at
+	next map[string]uint
+}
+
+// positionGap is the number of positions left between values of a field that
+// occurs more than once in a document so that phrases do not match across
+// values.
+const positionGap = 100
+
+func newParsedDoc(name string) *parsedDoc {
+	return &parsedDoc{
+		name:  name,
+		terms: make(map[string][]uint),
+		next:  make(map[string]uint),
+	}
+}
+
+// addTerms adds a list of terms that each occur once in a field.
+func (doc *parsedDoc) addTerms(field string, terms []string) {
+	for _, t := range terms {
+		key := fieldKey(field, t)
+		doc.terms[key] = append(doc.terms[key], 0)
+	}
+	doc.fields = append(doc.fields, field)
+}
+
+func (doc *parsedDoc) addKeyword(field, value string) {
+	doc.addTerms(field, []string{value})
+	if doc.keywords == nil {
+		doc.keywords = make(map[string][]string)
+	}
+	doc.keywords[field] = append(doc.keywords[field], value)
+}
+
+// addNumber adds the value of a numeric or date field in its sortable form.
+func (doc *parsedDoc) addNumber(field string, v uint64) {
+	doc.addTerms(field, trieTerms(v))
+	if doc.numbers == nil {
+		doc.numbers = make(map[string][]uint64)
+	}
+	doc.numbers[field] = append(doc.numbers[field], v)
+}
+
+// addField reads a tokenizer until it is exhausted so that a document is
+// never partially added to the index.
+func (doc *parsedDoc) addField(field string, tokens Tokenizer) error {
+	var (
+		start = doc.next[field]
+		last  = start
+	)
+	for {
+		tok, err := tokens.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		key := fieldKey(field, tok.Text)
+		last = start + tok.Pos
+		doc.length++
+		// (n+1)^2 - n^2 is added as the term's frequency grows by one.
+		doc.sumSquares += 2*len(doc.terms[key]) + 1
+		pos := append(doc.terms[key], last)
+		doc.terms[key] = pos
+		if len(pos) > doc.maxFreq {
+			doc.maxFreq = len(pos)
+		}
+	}
+	doc.next[field] = last + positionGap
+	doc.fields = append(doc.fields, field)
+	return nil
+}
+
+func (doc *parsedDoc) done() *parsedDoc {
+	if doc.maxFreq == 0 {
+		doc.maxFreq = 1
+	}
+	return doc
+}
+
+// parseDoc analyzes every field of a document.
+func (ix *Index) parseDoc(d *Document) (*parsedDoc, error) {
+	var (
+		err    error
+		stored []Field
+		doc    = newParsedDoc(d.Name)
+	)
+	for _, f := range d.Fields {
+		switch f.Type {
+		case NumericType:
+			doc.addNumber(f.Name, sortableFloat(f.Number))
+		case DateType:
+			doc.addNumber(f.Name, sortableTime(f.Time))
+		case KeywordType:
+			doc.addKeyword(f.Name, f.Value)
+		default:
+			tokens, err := ix.analyzerFor(f).Analyze(strings.NewReader(f.Value))
+			if err != nil {
+				return nil, err
+			}
+			if err = doc.addField(f.Name, tokens); err != nil {
+				return nil, err
+			}
+		}
+		if ix.isStored(f) {
+			stored = append(stored, f)
+		}
+	}
+	if len(stored) > 0 {
+		if doc.stored, err = encodeStoredFields(stored); err != nil {
+			return nil, err
+		}
+	}
+	return doc.done(), nil
+}
+
+// parseText analyzes a stream of text as the DefaultField of a document.
+func (ix *Index) parseText(name string, r io.Reader) (*parsedDoc, error) {
+	var (
+		body  strings.Builder
+		field = Field{Name: DefaultField}
+		store = ix.isStored(field)
+	)
+	if store {
+		r = io.TeeReader(r, &body)
+	}
+	tokens, err := ix.analyzerFor(field).Analyze(r)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseTokens(name, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if store {
+		// Make sure all of the text is stored even if the analyzer
+		// stopped reading early.
+		if _, err = io.Copy(io.Discard, r); err != nil {
+			return nil, err
+		}
+		field.Value = body.String()
+		if doc.stored, err = encodeStoredFields([]Field{field}); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (ix *Index) isStored(f Field) bool {
+	if f.Stored {
+		return true
+	}
+	_, ok := ix.storedFields[f.Name]
+	return ok
+}
+
+func parseTokens(name string, tokens Tokenizer) (*parsedDoc, error) {
+	doc := newParsedDoc(name)
+	if err := doc.addField(DefaultField, tokens); err != nil {
+		return nil, err
+	}
+	return doc.done(), nil
+}
+
+func (ix *Index) analyzerFor(f Field) Analyzer {
+	if f.Analyzer != nil {
+		return f.Analyzer
+	}
+	if a, ok := ix.fieldAnalyzers[f.Name]; ok {
+		return a
+	}
+	return ix.analyzer
+}
@@ -0,0 +1,152 @@
+package ts
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestFields(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	// The tags analyzer indexes the whole field as a single token.
+	tags := AnalyzerFunc(func(r io.Reader) (Tokenizer, error) {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return newTokenList([]string{strings.ToLower(string(b))}), nil
+	})
+	ix := NewIndex(WithFieldAnalyzer("tags", tags))
+	for _, doc := range []*Document{
+		NewDocument("raft",
+			TextField("title", "In Search of an Understandable Consensus Algorithm"),
+			TextField(DefaultField, "Raft is a consensus algorithm for managing a replicated log"),
+			TextField("author", "Diego Ongaro"),
+			TextField("tags", "Consensus-Algorithms"),
+		),
+		NewDocument("paxos",
+			TextField("title", "Paxos Made Simple"),
+			TextField(DefaultField, "The Paxos algorithm for implementing a fault-tolerant distributed system"),
+			TextField("author", "Leslie Lamport"),
+			TextField("tags", "consensus-algorithms"),
+		),
+		NewDocument("gfs",
+			TextField("title", "The Google File System"),
+			TextField(DefaultField, "a scalable distributed file system unlike raft"),
+			TextField("author", "Ghemawat"),
+		),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+
+	names := func(res []*QueryResult) map[string]bool {
+		m := make(map[string]bool)
+		for _, r := range res {
+			m[r.DocumentName] = true
+		}
+		return m
+	}
+	res := ix.Search(FieldQuery("title", "paxos"))
+	is.Equal(names(res), map[string]bool{"paxos": true})
+	res = ix.Search(StringQuery("raft"))
+	is.Equal(names(res), map[string]bool{"raft": true, "gfs": true})
+	res = ix.Search(FieldQuery("title", "raft"))
+	is.Equal(len(res), 0)
+	res = ix.Search(FieldQuery("author", "lamport"))
+	is.Equal(names(res), map[string]bool{"paxos": true})
+	res = ix.Search(FieldQuery("tags", "consensus-algorithms"))
+	is.Equal(names(res), map[string]bool{"raft": true, "paxos": true})
+
+	res = ix.Search(AnyFieldQuery("consensus"))
+	is.Equal(names(res), map[string]bool{"raft": true})
+	res = ix.Search(AnyFieldQuery("system"))
+	is.Equal(names(res), map[string]bool{"paxos": true, "gfs": true})
+	res = ix.Search(AnyFieldQuery("system", DefaultField))
+	is.Equal(names(res), map[string]bool{"gfs": true})
+
+	res = ix.Search(And(FieldQuery("title", "file"), StringQuery("distributed")))
+	is.Equal(names(res), map[string]bool{"gfs": true})
+	res = ix.Search(QueryTree(FieldQuery("title", "paxos"), StringQuery("raft")))
+	is.Equal(len(res), 3)
+	is.Equal(names(res), map[string]bool{"raft": true, "paxos": true, "gfs": true})
+
+	// Term queries are analyzed by their field's analyzer.
+	res = ix.Search(FieldQuery("tags", "Consensus-Algorithms"))
+	is.Equal(names(res), map[string]bool{"raft": true, "paxos": true})
+	ix = NewIndex(WithFieldAnalyzer("title", ProseAnalyzer))
+	_, err := ix.Add(NewDocument("raft", TextField("title", "Raft Consensus")))
+	is.NoErr(err)
+	parsed, err := ParseQuery("title:Raft")
+	is.NoErr(err)
+	for _, q := range []Query{FieldQuery("title", "Raft"), parsed, AnyFieldQuery("Consensus")} {
+		is.Equal(names(ix.Search(q)), map[string]bool{"raft": true})
+		is.Equal(names(ix.SearchTopK(q, 10)), map[string]bool{"raft": true})
+	}
+	is.Equal(len(ix.Search(FieldQuery("title", "raft"))), 0)
+}
+
+func TestStoredFields(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	store := NewMemStore()
+	ix := NewIndex(WithStore(store), WithStoredFields("author"))
+	id, err := ix.Add(NewDocument("raft",
+		StoredField("title", "In Search of an Understandable Consensus Algorithm"),
+		TextField(DefaultField, "Raft is a consensus algorithm for managing a replicated log"),
+		TextField("author", "Diego Ongaro"),
+	))
+	is.NoErr(err)
+	doc, err := ix.Document(id)
+	is.NoErr(err)
+	is.Equal(doc.Name, "raft")
+	is.Equal(doc.Fields, []Field{
+		StoredField("title", "In Search of an Understandable Consensus Algorithm"),
+		StoredField("author", "Diego Ongaro"),
+	})
+
+	res := ix.Search(StringQuery("raft"))
+	is.Equal(len(res), 1)
+	is.Equal(res[0].Fields, nil)
+	res = ix.Search(StringQuery("raft"), LoadFields())
+	is.Equal(res[0].Fields, map[string]string{
+		"title":  "In Search of an Understandable Consensus Algorithm",
+		"author": "Diego Ongaro",
+	})
+	res = ix.Search(StringQuery("raft"), LoadFields("author", DefaultField))
+	is.Equal(res[0].Fields, map[string]string{"author": "Diego Ongaro"})
+
+	is.NoErr(ix.Delete(id))
+	_, err = ix.Document(id)
+	is.Equal(err, ErrDocumentNotFound)
+	var b []byte
+	is.Equal(store.Get(storedFieldsKey(id), &b), ErrKeyNotFound)
+
+	ix = NewIndex(WithStoredFields(DefaultField))
+	body := strings.Repeat("the raft consensus algorithm ", 100)
+	id, err = ix.AddDocument("raft", strings.NewReader(body))
+	is.NoErr(err)
+	doc, err = ix.Document(id)
+	is.NoErr(err)
+	is.Equal(doc.Fields, []Field{StoredField(DefaultField, body)})
+	is.NoErr(ix.store.Get(storedFieldsKey(id), &b))
+	is.True(len(b) < len(body)) // compressed
+
+	// Numeric and date fields are stored from their typed values.
+	published := time.Date(2014, 6, 19, 0, 0, 0, 0, time.UTC)
+	id, err = ix.Add(NewDocument("raft",
+		Field{Name: "pages", Type: NumericType, Number: 16, Stored: true},
+		Field{Name: "published", Type: DateType, Time: published, Stored: true},
+	))
+	is.NoErr(err)
+	doc, err = ix.Document(id)
+	is.NoErr(err)
+	is.Equal(len(doc.Fields), 2)
+	is.Equal(doc.Fields[0].Number, 16.0)
+	is.Equal(doc.Fields[0].Value, "16")
+	is.True(doc.Fields[1].Time.Equal(published))
+}
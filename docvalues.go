@@ -0,0 +1,94 @@
+package ts
+
+// keywordColumn holds the values of a keyword field for every document so
+// that they can be read without loading the document. Each distinct value is
+// given an ordinal and documents hold the ordinals of their values, which
+// lets aggregations count values in a slice rather than a map.
+type keywordColumn struct {
+	// Distinct values of the field indexed by ordinal
+	values []string
+	ords   map[string]uint32
+	// Ordinals of each document's values indexed by DocID, nil if the
+	// document has no value for the field.
+	docs [][]uint32
+}
+
+func newKeywordColumn() *keywordColumn {
+	return &keywordColumn{ords: make(map[string]uint32)}
+}
+
+func (c *keywordColumn) add(id DocID, values []string) {
+	ords := make([]uint32, 0, len(values))
+	for _, v := range values {
+		ord, ok := c.ords[v]
+		if !ok {
+			ord = uint32(len(c.values))
+			c.ords[v] = ord
+			c.values = append(c.values, v)
+		}
+		if !containsOrd(ords, ord) {
+			ords = append(ords, ord)
+		}
+	}
+	for DocID(len(c.docs)) < id {
+		c.docs = append(c.docs, nil)
+	}
+	c.docs = append(c.docs, ords)
+}
+
+// get returns the ordinals of a document's values.
+func (c *keywordColumn) get(id DocID) []uint32 {
+	if id >= DocID(len(c.docs)) {
+		return nil
+	}
+	return c.docs[id]
+}
+
+func containsOrd(ords []uint32, ord uint32) bool {
+	for _, o := range ords {
+		if o == ord {
+			return true
+		}
+	}
+	return false
+}
+
+// numericColumn holds the values of a numeric or date field for every
+// document so that results can be sorted without loading the documents.
+// Values are kept in their sortable form and only the lowest and highest
+// value of a document are kept, which are the values used to sort in
+// ascending and descending order.
+type numericColumn struct {
+	// Lowest and highest value of each document indexed by DocID
+	lo, hi []uint64
+	// Set for the documents that have a value
+	has []bool
+}
+
+func newNumericColumn() *numericColumn {
+	return &numericColumn{}
+}
+
+func (c *numericColumn) add(id DocID, values []uint64) {
+	for DocID(len(c.has)) < id {
+		c.lo, c.hi, c.has = append(c.lo, 0), append(c.hi, 0), append(c.has, false)
+	}
+	var lo, hi uint64
+	for i, v := range values {
+		if i == 0 || v < lo {
+			lo = v
+		}
+		if i == 0 || v > hi {
+			hi = v
+		}
+	}
+	c.lo, c.hi, c.has = append(c.lo, lo), append(c.hi, hi), append(c.has, len(values) > 0)
+}
+
+// get returns the lowest and highest value of a document.
+func (c *numericColumn) get(id DocID) (lo, hi uint64, ok bool) {
+	if id >= DocID(len(c.has)) || !c.has[id] {
+		return 0, 0, false
+	}
+	return c.lo[id], c.hi[id], true
+}
@@ -0,0 +1,57 @@
+package ts
+
+import "strconv"
+
+// FuzzyQuery matches documents containing a term in the DefaultField that is
+// within maxEdits insertions, deletions or substitutions of term. Matches are
+// scored lower the more edits they need. Only the maxExpansions closest terms
+// are searched, or DefaultMaxExpansions if maxExpansions is not positive,
+// preferring terms found in more documents when terms are equally close.
+func FuzzyQuery(term string, maxEdits, maxExpansions int) Query {
+	if maxEdits < 0 {
+		maxEdits = 0
+	}
+	if maxExpansions <= 0 {
+		maxExpansions = DefaultMaxExpansions
+	}
+	return &fuzzyQuery{
+		field:         DefaultField,
+		token:         string(cleanWord(term)),
+		maxEdits:      maxEdits,
+		maxExpansions: maxExpansions,
+	}
+}
+
+type fuzzyQuery struct {
+	field, token string
+	maxEdits     int
+	// Match terms that start with a prefix within maxEdits of token
+	prefix        bool
+	maxExpansions int
+}
+
+func (fq *fuzzyQuery) Keys() []string { return []string{fq.token} }
+
+func (fq *fuzzyQuery) String() string {
+	s := fieldPrefix(fq.field) + escapeTerm(fq.token)
+	if fq.prefix {
+		s += "*"
+	}
+	return s + "~" + strconv.Itoa(fq.maxEdits)
+}
+
+func (fq *fuzzyQuery) search(ix *Index) []*posting {
+	if fq.token == "" {
+		return nil
+	}
+	query := []rune(fq.token)
+	terms := ix.matchTerms(fq.field, "", func(token string) (int, bool) {
+		if fq.prefix {
+			return boundedPrefixLevenshtein(query, []rune(token), fq.maxEdits)
+		}
+		return boundedLevenshtein(query, []rune(token), fq.maxEdits)
+	})
+	return expand(ix, fq.field, terms, fq.maxExpansions)
+}
+
+var _ Query = (*fuzzyQuery)(nil)
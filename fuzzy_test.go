@@ -0,0 +1,59 @@
+package ts
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestFuzzyQuery(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	for _, doc := range []*Document{
+		NewDocument("exact", TextField(DefaultField, "consensus protocols")),
+		NewDocument("one", TextField(DefaultField, "consensos protocols")),
+		NewDocument("two", TextField(DefaultField, "konsensos protocols")),
+		NewDocument("far", TextField(DefaultField, "census protocols")),
+		NewDocument("other", TextField(DefaultField, "consensus"), TextField("title", "consenses")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(res []*QueryResult) []string {
+		names := make([]string, 0, len(res))
+		for _, r := range res {
+			names = append(names, r.DocumentName)
+		}
+		return names
+	}
+	sorted := func(res []*QueryResult) []string {
+		n := names(res)
+		sort.Strings(n)
+		return n
+	}
+	is.Equal(sorted(ix.Search(FuzzyQuery("consensus", 0, 0))), []string{"exact", "other"})
+	res := ix.Search(FuzzyQuery("Consensus", 2, 0))
+	is.Equal(sorted(res[:2]), []string{"exact", "other"})
+	is.Equal(names(res[2:]), []string{"one", "two"})
+	is.True(res[1].Rank > res[2].Rank)
+	is.True(res[2].Rank > res[3].Rank)
+	is.Equal(sorted(ix.Search(FuzzyQuery("konsensus", 1, 0))), []string{"exact", "other", "two"})
+	is.Equal(len(ix.Search(FuzzyQuery("zzzz", 2, 0))), 0)
+
+	is.NoErr(ix.Delete(ix.names["two"]))
+	is.Equal(sorted(ix.Search(FuzzyQuery("konsensus", 1, 0))), []string{"exact", "other"})
+
+	// Only the closest terms are expanded.
+	ix = NewIndex()
+	for i := 0; i < 10; i++ {
+		_, err := ix.Add(NewDocument(fmt.Sprint(i), TextField(DefaultField, fmt.Sprintf("term%d", i))))
+		is.NoErr(err)
+	}
+	_, err := ix.Add(NewDocument("exact", TextField(DefaultField, "term")))
+	is.NoErr(err)
+	is.Equal(sorted(ix.Search(FuzzyQuery("term", 1, 3))), []string{"0", "1", "exact"})
+	is.Equal(len(ix.Search(FuzzyQuery("term", 1, 0))), 11)
+}
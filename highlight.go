@@ -0,0 +1,224 @@
+package ts
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Highlighter configures the snippets that are returned with search results.
+// Snippets are taken from the stored value of a field, so the field must be
+// stored for it to be highlighted.
+type Highlighter struct {
+	// Field that snippets are taken from. Defaults to DefaultField.
+	Field string
+	// FragmentSize is the maximum length of a fragment in bytes, not
+	// counting tags. Defaults to 100.
+	FragmentSize int
+	// Fragments is the maximum number of fragments for each result.
+	// Defaults to 3.
+	Fragments int
+	// PreTag and PostTag surround each matched term. Defaults to "<em>" and
+	// "</em>". Text is not escaped.
+	PreTag, PostTag string
+}
+
+// Highlight adds snippets of text with the query terms highlighted to the
+// Snippets of each search result.
+func Highlight(h Highlighter) SearchOption {
+	if h.Field == "" {
+		h.Field = DefaultField
+	}
+	if h.FragmentSize <= 0 {
+		h.FragmentSize = 100
+	}
+	if h.Fragments <= 0 {
+		h.Fragments = 3
+	}
+	if h.PreTag == "" && h.PostTag == "" {
+		h.PreTag, h.PostTag = "<em>", "</em>"
+	}
+	return func(so *searchOptions) { so.highlight = &h }
+}
+
+type span struct{ start, end int }
+
+type fragment struct {
+	span
+	matches []span
+}
+
+// highlight sets the snippets of a search result. Results without a stored
+// value for the field are left without snippets.
+func (ix *Index) highlight(r *QueryResult, query Query, h *Highlighter) {
+	fields, err := ix.loadFields(r.DocumentID)
+	if err != nil {
+		return
+	}
+	keys := make(map[string]struct{})
+	for _, k := range ix.queryKeys(query) {
+		keys[k] = struct{}{}
+	}
+	for _, f := range fields {
+		if f.Name != h.Field {
+			continue
+		}
+		matches, err := ix.matchSpans(f, keys)
+		if err != nil {
+			return
+		}
+		for _, frag := range fragments(f.Value, matches, h) {
+			r.Snippets = append(r.Snippets, h.render(f.Value, frag))
+		}
+	}
+}
+
+// queryKeys returns the keys of a query with terms and phrases analyzed by
+// their field's analyzer, so they match the tokens of the field.
+func (ix *Index) queryKeys(q Query) []string {
+	var keys []string
+	switch q := q.(type) {
+	case *phraseQuery:
+		return tokenTexts(q.analyze(ix))
+	case StringQuery:
+		return ix.analyzeTerm(DefaultField, string(q))
+	case *fieldQuery:
+		if q.keyword {
+			return q.Keys()
+		}
+		return ix.analyzeTerm(q.field, q.text)
+	case *unionQuery:
+		for _, text := range q.queries {
+			keys = append(keys, ix.analyzeTerm(DefaultField, text)...)
+		}
+	case *anyFieldQuery:
+		for field := range ix.fields {
+			if _, ok := q.exclude[field]; !ok {
+				keys = append(keys, ix.analyzeTerm(field, q.text)...)
+			}
+		}
+	case *boostQuery:
+		return ix.queryKeys(q.query)
+	case *intersectQuery:
+		for _, sub := range q.queries {
+			keys = append(keys, ix.queryKeys(sub)...)
+		}
+	case *queryTree:
+		keys = append(ix.queryKeys(q.left), ix.queryKeys(q.right)...)
+	case *BoolQuery:
+		for _, sub := range q.Must {
+			keys = append(keys, ix.queryKeys(sub)...)
+		}
+		for _, sub := range q.Should {
+			keys = append(keys, ix.queryKeys(sub)...)
+		}
+	default:
+		keys = q.Keys()
+	}
+	return keys
+}
+
+// matchSpans re-analyzes a field to find the offsets of the query terms.
+func (ix *Index) matchSpans(f Field, keys map[string]struct{}) ([]span, error) {
+	var matches []span
+	if f.Type != TextType {
+		if _, ok := keys[f.Value]; ok {
+			matches = append(matches, span{0, len(f.Value)})
+		}
+		return matches, nil
+	}
+	tokens, err := ix.analyzerFor(f).Analyze(strings.NewReader(f.Value))
+	if err != nil {
+		return nil, err
+	}
+	toks, err := readAllTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, tok := range toks {
+		if _, ok := keys[tok.Text]; ok && tok.Start < tok.End && tok.End <= len(f.Value) {
+			matches = append(matches, span{tok.Start, tok.End})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	return matches, nil
+}
+
+// fragments splits the text around the matches into fragments and returns
+// the fragments with the most matches in the order they appear in the text.
+func fragments(text string, matches []span, h *Highlighter) []fragment {
+	var (
+		frags []fragment
+		prev  int
+	)
+	for i := 0; i < len(matches); {
+		if matches[i].start < prev {
+			// Overlapping matches are skipped.
+			i++
+			continue
+		}
+		frag := fragment{span: fragmentSpan(text, prev, matches[i], h.FragmentSize)}
+		for ; i < len(matches) && matches[i].end <= frag.end; i++ {
+			if matches[i].start >= frag.start && matches[i].start >= prev {
+				frag.matches = append(frag.matches, matches[i])
+				prev = matches[i].end
+			}
+		}
+		prev = frag.end
+		frags = append(frags, frag)
+	}
+	if len(frags) > h.Fragments {
+		sort.SliceStable(frags, func(i, j int) bool {
+			return len(frags[i].matches) > len(frags[j].matches)
+		})
+		frags = frags[:h.Fragments]
+		sort.Slice(frags, func(i, j int) bool { return frags[i].start < frags[j].start })
+	}
+	return frags
+}
+
+// fragmentSpan returns a span of at most size bytes that starts after from,
+// is centered on a match when possible and is trimmed to whole words. The
+// span is only longer than size when the match is.
+func fragmentSpan(text string, from int, m span, size int) span {
+	start := m.start - (size-(m.end-m.start))/2
+	if start < from {
+		start = from
+	}
+	if start > 0 && text[start-1] != ' ' {
+		if i := strings.IndexByte(text[start:m.start], ' '); i >= 0 {
+			start += i + 1
+		} else {
+			start = m.start
+		}
+	}
+	end := start + size
+	if end < m.end {
+		end = m.end
+	}
+	if end >= len(text) {
+		return span{start, len(text)}
+	}
+	if i := strings.LastIndexAny(text[m.end:end+1], " \n"); i >= 0 {
+		end = m.end + i
+	} else {
+		for end > m.end && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+	return span{start, end}
+}
+
+func (h *Highlighter) render(text string, frag fragment) string {
+	var b strings.Builder
+	pos := frag.start
+	for _, m := range frag.matches {
+		b.WriteString(text[pos:m.start])
+		b.WriteString(h.PreTag)
+		b.WriteString(text[m.start:m.end])
+		b.WriteString(h.PostTag)
+		pos = m.end
+	}
+	b.WriteString(text[pos:frag.end])
+	return strings.TrimSpace(b.String())
+}
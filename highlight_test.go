@@ -0,0 +1,121 @@
+package ts
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestTokenOffsets(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	text := "The (Raft) protocol,\nis  understandable."
+	for _, a := range []Analyzer{SimpleAnalyzer, ProseAnalyzer} {
+		tokens, err := a.Analyze(strings.NewReader(text))
+		is.NoErr(err)
+		found := make(map[string]string)
+		for {
+			tok, err := tokens.Next()
+			if err == io.EOF {
+				break
+			}
+			is.NoErr(err)
+			found[strings.ToLower(tok.Text)] = text[tok.Start:tok.End]
+		}
+		is.Equal(found["raft"], "Raft")
+		is.Equal(found["protocol"], "protocol")
+		is.Equal(found["understandable"], "understandable")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithStoredFields(DefaultField))
+	body := "Raft is a consensus algorithm for managing a replicated log. " +
+		"It produces a result equivalent to Paxos and it is as efficient as Paxos, " +
+		"but its structure is different from Paxos. In order to enhance " +
+		"understandability Raft separates the key elements of consensus."
+	_, err := ix.AddDocument("raft", strings.NewReader(body))
+	is.NoErr(err)
+	_, err = ix.Add(NewDocument("gfs", TextField(DefaultField, "a scalable distributed file system")))
+	is.NoErr(err)
+
+	res := ix.Search(StringQuery("raft"))
+	is.Equal(res[0].Snippets, nil)
+
+	res = ix.Search(StringQuery("raft"), Highlight(Highlighter{FragmentSize: 40}))
+	is.Equal(len(res), 1)
+	is.Equal(res[0].Snippets, []string{
+		"<em>Raft</em> is a consensus algorithm for",
+		"understandability <em>Raft</em> separates the key",
+	})
+
+	res = ix.Search(Or("paxos", "consensus"), Highlight(Highlighter{
+		FragmentSize: 60,
+		Fragments:    1,
+		PreTag:       "[",
+		PostTag:      "]",
+	}))
+	is.Equal(res[0].Snippets, []string{"[Paxos], but its structure is different from [Paxos]. In order"})
+
+	res = ix.Search(StringQuery("distributed"), Highlight(Highlighter{}))
+	is.Equal(res[0].Snippets, []string{"a scalable <em>distributed</em> file system"})
+	// Fields without a stored value have no snippets.
+	res = ix.Search(StringQuery("distributed"), Highlight(Highlighter{Field: "title"}))
+	is.Equal(len(res), 1)
+	is.Equal(res[0].Snippets, nil)
+}
+
+func TestHighlightAnalyzedPhrase(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithStoredFields(DefaultField), WithFieldAnalyzer(DefaultField, pluralAnalyzer))
+	_, err := ix.AddDocument("raft", strings.NewReader("Raft manages replicated logs across servers."))
+	is.NoErr(err)
+	for _, q := range []Query{
+		PhraseQuery(DefaultField, "replicated logs"),
+		And(StringQuery("raft"), PhraseQuery(DefaultField, "replicated log")),
+	} {
+		res := ix.Search(q, Highlight(Highlighter{}))
+		is.Equal(len(res), 1)
+		is.True(strings.Contains(res[0].Snippets[0], "<em>replicated</em> <em>logs</em>"))
+	}
+}
+
+// pluralAnalyzer is the SimpleAnalyzer with a trailing s removed from each
+// token.
+var pluralAnalyzer = AnalyzerFunc(func(r io.Reader) (Tokenizer, error) {
+	tokens, err := SimpleAnalyzer.Analyze(r)
+	if err != nil {
+		return nil, err
+	}
+	return pluralTokenizer{tokens}, nil
+})
+
+type pluralTokenizer struct{ Tokenizer }
+
+func (pt pluralTokenizer) Next() (Token, error) {
+	tok, err := pt.Tokenizer.Next()
+	tok.Text = strings.TrimSuffix(tok.Text, "s")
+	return tok, err
+}
+
+func TestHighlightAccentedText(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	text := "café résumé naïve election results"
+	for _, a := range []Analyzer{SimpleAnalyzer, ProseAnalyzer} {
+		ix := NewIndex(WithStoredFields(DefaultField), WithAnalyzer(a))
+		_, err := ix.AddDocument("accents", strings.NewReader(text))
+		is.NoErr(err)
+		res := ix.Search(StringQuery("election"), Highlight(Highlighter{}))
+		is.Equal(len(res), 1)
+		is.Equal(res[0].Snippets, []string{"café résumé naïve <em>election</em> results"})
+		res = ix.Search(StringQuery("naive"), Highlight(Highlighter{}))
+		is.Equal(len(res), 1)
+		is.Equal(res[0].Snippets, []string{"café résumé <em>naïve</em> election results"})
+	}
+}
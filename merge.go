@@ -0,0 +1,231 @@
+package ts
+
+import "math"
+
+// SegmentInfo describes a segment of an index to a MergePolicy.
+type SegmentInfo struct {
+	// Docs is the number of documents in the segment including deleted
+	// documents.
+	Docs int
+	// Deleted is the number of deleted documents in the segment.
+	Deleted int
+	// Merging is true if the segment is already being merged. Segments that
+	// are being merged cannot be merged again.
+	Merging bool
+}
+
+func (si SegmentInfo) live() int { return si.Docs - si.Deleted }
+
+// Merge is a range [Start, End) of adjacent segments that will be merged into
+// a single segment.
+type Merge struct{ Start, End int }
+
+// MergePolicy decides which segments of an index are merged. Segments are
+// given in document ID order and only adjacent segments can be merged
+// together. Merging a single segment purges its deleted documents.
+type MergePolicy interface {
+	FindMerges(segments []SegmentInfo) []Merge
+}
+
+// NewTieredMergePolicy creates a TieredMergePolicy with default settings.
+func NewTieredMergePolicy() *TieredMergePolicy {
+	return &TieredMergePolicy{
+		SegmentsPerTier:   10,
+		MaxMergeAtOnce:    10,
+		FloorSegmentDocs:  1000,
+		DeletesPctAllowed: 33,
+	}
+}
+
+// TieredMergePolicy merges segments of roughly equal size once the index has
+// more segments than its tiers allow. Each tier holds SegmentsPerTier
+// segments and every tier's segments are MaxMergeAtOnce times larger than the
+// tier below it.
+type TieredMergePolicy struct {
+	// SegmentsPerTier is the number of segments allowed in each tier.
+	SegmentsPerTier int
+	// MaxMergeAtOnce is the largest number of segments merged at once.
+	MaxMergeAtOnce int
+	// FloorSegmentDocs is the size that smaller segments are rounded up to
+	// when computing tiers, this stops lots of tiny segments from being
+	// merged one tier at a time.
+	FloorSegmentDocs int
+	// DeletesPctAllowed is the percentage of a segment's documents that can
+	// be deleted before it is merged on its own to purge the deletions.
+	DeletesPctAllowed float64
+}
+
+func (tp *TieredMergePolicy) FindMerges(segments []SegmentInfo) []Merge {
+	var (
+		merges    []Merge
+		used      = make([]bool, len(segments))
+		eligible  int
+		total     int
+		smallest  = maxInt
+		perTier   = atLeast(tp.SegmentsPerTier, 2)
+		atOnce    = atLeast(tp.MaxMergeAtOnce, 2)
+		floorSize = atLeast(tp.FloorSegmentDocs, 1)
+	)
+	for i, s := range segments {
+		if s.Merging {
+			used[i] = true
+			continue
+		}
+		if s.Docs > 0 && float64(s.Deleted)*100 > tp.DeletesPctAllowed*float64(s.Docs) {
+			merges = append(merges, Merge{Start: i, End: i + 1})
+			used[i] = true
+			continue
+		}
+		eligible++
+		size := atLeast(s.live(), floorSize)
+		total += size
+		if size < smallest {
+			smallest = size
+		}
+	}
+	if eligible < 2 {
+		return merges
+	}
+
+	// Count the number of segments the index is allowed to have.
+	var (
+		allowed   float64
+		levelSize = float64(smallest)
+		remaining = float64(total)
+	)
+	for {
+		count := remaining / levelSize
+		if count < float64(perTier) {
+			allowed += math.Ceil(count)
+			break
+		}
+		allowed += float64(perTier)
+		remaining -= float64(perTier) * levelSize
+		levelSize *= float64(atOnce)
+	}
+	if float64(eligible) <= allowed {
+		return merges
+	}
+
+	// Pick the run of adjacent segments with the lowest skew.
+	var (
+		best      *Merge
+		bestScore = math.Inf(1)
+	)
+	for start := range segments {
+		var (
+			end      = start
+			largest  int
+			windowSz int
+		)
+		for end < len(segments) && end-start < atOnce && !used[end] {
+			size := atLeast(segments[end].live(), floorSize)
+			if size > largest {
+				largest = size
+			}
+			windowSz += size
+			end++
+		}
+		if end-start < 2 {
+			continue
+		}
+		// Prefer merges of equally sized segments and smaller merges.
+		skew := float64(largest) / float64(windowSz)
+		score := skew * math.Pow(float64(windowSz), 0.05)
+		if score < bestScore {
+			bestScore = score
+			best = &Merge{Start: start, End: end}
+		}
+	}
+	if best != nil {
+		merges = append(merges, *best)
+	}
+	return merges
+}
+
+// NewLogMergePolicy creates a LogMergePolicy with default settings.
+func NewLogMergePolicy() *LogMergePolicy {
+	return &LogMergePolicy{MergeFactor: 10, MinMergeDocs: 1000}
+}
+
+// LogMergePolicy groups segments into levels by the logarithm of their size
+// and merges MergeFactor adjacent segments of the same level.
+//
+// Segments within three quarters of a level of the largest remaining segment
+// are grouped into its level, as are the smaller segments between them, so
+// a small segment next to a larger one is still merged when merges finish
+// out of order.
+type LogMergePolicy struct {
+	// MergeFactor is the number of segments merged together and the base of
+	// the logarithm used to compute segment levels.
+	MergeFactor int
+	// MinMergeDocs is the size that smaller segments are rounded up to when
+	// computing levels.
+	MinMergeDocs int
+}
+
+// levelSpan is how far below the highest level a segment can be and still
+// be merged as part of that level.
+const levelSpan = 0.75
+
+func (lp *LogMergePolicy) FindMerges(segments []SegmentInfo) []Merge {
+	var (
+		merges   []Merge
+		factor   = atLeast(lp.MergeFactor, 2)
+		minDocs  = atLeast(lp.MinMergeDocs, 1)
+		levels   = make([]float64, len(segments))
+		logBase  = math.Log(float64(factor))
+		minLevel = math.Log(float64(minDocs)) / logBase
+	)
+	for i, s := range segments {
+		levels[i] = math.Log(float64(atLeast(s.live(), minDocs))) / logBase
+	}
+	for start := 0; start < len(segments); {
+		top := levels[start]
+		for _, l := range levels[start+1:] {
+			if l > top {
+				top = l
+			}
+		}
+		// Find the last segment of the highest level, every segment before
+		// it is merged as part of the level.
+		bottom := top - levelSpan
+		if top <= minLevel {
+			bottom = -1
+		} else if bottom < minLevel {
+			bottom = minLevel
+		}
+		last := len(segments) - 1
+		for levels[last] < bottom {
+			last--
+		}
+		for end := start + factor; end <= last+1; end += factor {
+			if !anyMergingInfo(segments[end-factor : end]) {
+				merges = append(merges, Merge{Start: end - factor, End: end})
+			}
+		}
+		start = last + 1
+	}
+	return merges
+}
+
+func anyMergingInfo(segments []SegmentInfo) bool {
+	for _, s := range segments {
+		if s.Merging {
+			return true
+		}
+	}
+	return false
+}
+
+func atLeast(n, min int) int {
+	if n < min {
+		return min
+	}
+	return n
+}
+
+var (
+	_ MergePolicy = (*TieredMergePolicy)(nil)
+	_ MergePolicy = (*LogMergePolicy)(nil)
+)
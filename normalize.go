@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"io"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/jdkato/prose/v2"
@@ -12,26 +13,79 @@ import (
 	"golang.org/x/text/unicode/norm"
 )
 
-var transformer = transform.Chain(
-	norm.NFD,
-	runes.Remove(runes.In(unicode.Mn)),
-	norm.NFKD,
-)
+// Transformer chains keep internal state so they are pooled to allow text
+// to be normalized from multiple goroutines.
+var transformers = sync.Pool{
+	New: func() interface{} {
+		return transform.Chain(
+			norm.NFD,
+			runes.Remove(runes.In(unicode.Mn)),
+			norm.NFKD,
+		)
+	},
+}
+
+func normalize(s string) (string, error) {
+	t := transformers.Get().(transform.Transformer)
+	defer transformers.Put(t)
+	res, _, err := transform.String(t, s)
+	return res, err
+}
+
+// Token is a single term produced by a Tokenizer.
+type Token struct {
+	// Text is the normalized text of the token.
+	Text string
+	// Pos is the ordinal position of the token in the source text.
+	Pos uint
+	// Start and End are the byte offsets of the token in the source text.
+	Start, End int
+}
+
+// Tokenizer produces a stream of tokens. Next returns io.EOF when the stream
+// is exhausted.
+type Tokenizer interface{ Next() (Token, error) }
 
-type token struct {
-	text string
-	pos  uint
+// Analyzer converts raw text into a stream of tokens.
+type Analyzer interface {
+	Analyze(io.Reader) (Tokenizer, error)
 }
 
-type tokenizer interface{ Next() (token, error) }
+// AnalyzerFunc is an adapter to allow the use of an ordinary function as an
+// Analyzer.
+type AnalyzerFunc func(io.Reader) (Tokenizer, error)
+
+// Analyze calls f(r).
+func (f AnalyzerFunc) Analyze(r io.Reader) (Tokenizer, error) { return f(r) }
+
+var (
+	// SimpleAnalyzer splits text on whitespace, normalizes each word and
+	// removes stop words.
+	SimpleAnalyzer Analyzer = AnalyzerFunc(func(r io.Reader) (Tokenizer, error) {
+		return newCustomTokenizer(r), nil
+	})
+	// ProseAnalyzer uses the prose library's tokenizer to split text into
+	// tokens.
+	ProseAnalyzer Analyzer = AnalyzerFunc(func(r io.Reader) (Tokenizer, error) {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return newTokenizer(string(body))
+	})
+)
 
 type customTokenizer struct {
-	buf   *bufio.Reader
-	cache []token
-	pos   uint
+	buf *bufio.Reader
+	// Tokens read from the current segment in the order they were found
+	cache []Token
+	// Position of the next word
+	pos uint
+	// Byte offset of the next segment in the source text
+	offset int
 }
 
-func (ct *customTokenizer) Next() (token, error) {
+func (ct *customTokenizer) Next() (Token, error) {
 	var (
 		err     error
 		segment string
@@ -43,24 +97,37 @@ func (ct *customTokenizer) Next() (token, error) {
 	}
 Next:
 	segment, err = ct.buf.ReadString(' ')
-	if err != nil {
-		return token{}, err
+	// The last segment is returned along with io.EOF.
+	if err != nil && (err != io.EOF || len(segment) == 0) {
+		return Token{}, err
 	}
+	start := ct.offset
+	ct.offset += len(segment)
 	parts = strings.Split(segment, "\n")
-	for _, b := range parts {
-		b = strings.Trim(b, " \n\t\r")
+	for _, part := range parts {
+		offset := start
+		start += len(part) + 1
+		b := strings.TrimLeft(part, " \n\t\r")
+		offset += len(part) - len(b)
+		b = strings.TrimRight(b, " \n\t\r")
 		raw = cleanWord(b)
 		if len(raw) == 0 {
 			continue
 		}
+		// Stop words are counted so that the positions of the remaining
+		// tokens keep the gaps the stop words left.
+		pos := ct.pos
+		ct.pos++
 		tok := string(raw)
 		if IsStopWord(tok) {
 			continue
 		}
-		ct.pos++
-		ct.cache = append(ct.cache, token{
-			pos:  ct.pos,
-			text: tok,
+		b, trimmed := trimWord(b)
+		ct.cache = append(ct.cache, Token{
+			Pos:   pos,
+			Text:  tok,
+			Start: offset + trimmed,
+			End:   offset + trimmed + len(b),
 		})
 	}
 	if len(ct.cache) == 0 {
@@ -69,23 +136,58 @@ Next:
 	return ct.pop()
 }
 
-func (ct *customTokenizer) pop() (token, error) {
+func (ct *customTokenizer) pop() (Token, error) {
 	if len(ct.cache) == 0 {
-		return token{}, io.EOF
+		return Token{}, io.EOF
 	}
-	res := ct.cache[len(ct.cache)-1]
-	ct.cache = ct.cache[:len(ct.cache)-1]
+	res := ct.cache[0]
+	ct.cache = ct.cache[1:]
 	return res, nil
 }
 
+// trimWord removes the punctuation around a word that cleanWord removes and
+// returns the number of bytes removed from the front of the word.
+func trimWord(w string) (string, int) {
+	w = strings.TrimRight(w, ".,!?:;)")
+	if len(w) > 1 && w[0] == '(' {
+		return w[1:], 1
+	}
+	return w, 0
+}
+
 func newCustomTokenizer(r io.Reader) *customTokenizer {
 	return &customTokenizer{
 		buf: bufio.NewReader(r),
 	}
 }
 
-func newTokenizer(body string) (tokenizer, error) {
-	s, _, err := transform.String(transformer, body)
+// normalizeSpans normalizes text and returns the span of the source text
+// that each byte of the normalized text came from. Text is normalized one
+// normalization segment at a time, so the bytes of a segment map back to
+// the whole segment, such as an accented letter and its combining marks.
+func normalizeSpans(text string) (s string, starts, ends []int, err error) {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		n := norm.NFKD.NextBoundaryInString(text[i:], true)
+		if n <= 0 {
+			n = len(text) - i
+		}
+		seg, err := normalize(text[i : i+n])
+		if err != nil {
+			return "", nil, nil, err
+		}
+		b.WriteString(seg)
+		for j := 0; j < len(seg); j++ {
+			starts = append(starts, i)
+			ends = append(ends, i+n)
+		}
+		i += n
+	}
+	return b.String(), starts, ends, nil
+}
+
+func newTokenizer(body string) (Tokenizer, error) {
+	s, starts, ends, err := normalizeSpans(body)
 	if err != nil {
 		return nil, err
 	}
@@ -99,15 +201,33 @@ func newTokenizer(body string) (tokenizer, error) {
 	if err != nil {
 		return nil, err
 	}
-	toks := doc.Tokens()
-	tokens := make([]string, 0, len(toks))
+	var (
+		toks   = doc.Tokens()
+		tokens = make([]string, 0, len(toks))
+		spans  = make([][2]int, 0, len(toks))
+		offset = 0
+	)
+	// Prose does not report where tokens were found so each token is
+	// located in the normalized text after the end of the previous one and
+	// then mapped back to the source text.
 	for _, t := range toks {
+		if i := strings.Index(s[offset:], t.Text); i >= 0 {
+			offset += i
+		}
 		tokens = append(tokens, t.Text)
+		span := [2]int{len(body), len(body)}
+		if end := offset + len(t.Text); len(t.Text) > 0 && end <= len(s) {
+			span = [2]int{starts[offset], ends[end-1]}
+		}
+		spans = append(spans, span)
+		offset += len(t.Text)
 	}
-	return newTokenList(tokens), nil
+	tl := newTokenList(tokens)
+	tl.spans = spans
+	return tl, nil
 }
 
-func mustNewTokenizer(body string) tokenizer {
+func mustNewTokenizer(body string) Tokenizer {
 	t, err := newTokenizer(body)
 	if err != nil {
 		panic(err)
@@ -121,10 +241,16 @@ func newTokenList(tokens []string) *tokenlist {
 
 type tokenlist struct {
 	tokens []string
-	i      uint
+	// Start and end byte offsets of each token in the source text, nil if
+	// the offsets are unknown
+	spans [][2]int
+	i     uint
+	// Position of the next word. Punctuation is skipped without taking up
+	// a position.
+	pos uint
 }
 
-func (tl *tokenlist) Next() (token, error) {
+func (tl *tokenlist) Next() (Token, error) {
 loop:
 	for tl.i < uint(len(tl.tokens)) {
 		switch tl.tokens[tl.i] {
@@ -135,15 +261,19 @@ loop:
 		}
 	}
 	if tl.i < uint(len(tl.tokens)) {
-		t := token{pos: tl.i, text: tl.tokens[tl.i]}
+		t := Token{Pos: tl.pos, Text: tl.tokens[tl.i]}
+		if tl.spans != nil {
+			t.Start, t.End = tl.spans[tl.i][0], tl.spans[tl.i][1]
+		}
 		tl.i++
+		tl.pos++
 		return t, nil
 	}
-	return token{}, io.EOF
+	return Token{}, io.EOF
 }
 
 func cleanWord(w string) []rune {
-	buf, _, err := transform.String(transformer, w)
+	buf, err := normalize(w)
 	if err != nil {
 		panic(err)
 	}
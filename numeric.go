@@ -0,0 +1,170 @@
+package ts
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Numeric and date values are indexed as trie terms. A value is converted to
+// an unsigned integer that sorts in the same order as the value and then a
+// term is added for every precisionStep bits of the integer. The term at a
+// shift s holds the value with its lowest s bits removed so each term matches
+// every value in a range of 2^s values. A range query is split into the
+// fewest terms that exactly cover the range.
+const (
+	precisionStep = 8
+	// trie terms are a one byte shift followed by a big endian uint64
+	trieTermSize = 9
+)
+
+// sortableFloat converts a float64 into a uint64 with the same ordering.
+func sortableFloat(f float64) uint64 {
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
+
+// sortableTime converts a time into a uint64 with the same ordering.
+func sortableTime(t time.Time) uint64 {
+	return uint64(t.UnixNano()) ^ 1<<63
+}
+
+func trieTerm(shift uint, v uint64) string {
+	var b [trieTermSize]byte
+	b[0] = byte(shift)
+	v >>= shift
+	for i := trieTermSize - 1; i > 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b[:])
+}
+
+// trieTerms returns the terms that a value is indexed under.
+func trieTerms(v uint64) []string {
+	terms := make([]string, 0, 64/precisionStep)
+	for shift := uint(0); shift < 64; shift += precisionStep {
+		terms = append(terms, trieTerm(shift, v))
+	}
+	return terms
+}
+
+// splitRange returns the trie terms that cover the values [lo, hi].
+func splitRange(lo, hi uint64) []string {
+	var terms []string
+	if lo > hi {
+		return nil
+	}
+	addRange := func(lo, hi uint64, shift uint) {
+		for p, end := lo>>shift, hi>>shift; ; p++ {
+			terms = append(terms, trieTerm(shift, p<<shift))
+			if p == end {
+				break
+			}
+		}
+	}
+	for shift := uint(0); ; shift += precisionStep {
+		if shift+precisionStep >= 64 {
+			addRange(lo, hi, shift)
+			break
+		}
+		var (
+			diff     = uint64(1) << (shift + precisionStep)
+			mask     = (uint64(1)<<precisionStep - 1) << shift
+			hasLower = lo&mask != 0
+			hasUpper = hi&mask != mask
+			nextLo   = lo
+			nextHi   = hi
+		)
+		if hasLower {
+			nextLo += diff
+		}
+		if hasUpper {
+			nextHi -= diff
+		}
+		nextLo &^= mask
+		nextHi &^= mask
+		if nextLo > nextHi || nextLo < lo || nextHi > hi {
+			// The next precision cannot represent the rest of the range.
+			addRange(lo, hi, shift)
+			break
+		}
+		if hasLower {
+			addRange(lo, lo|mask, shift)
+		}
+		if hasUpper {
+			addRange(hi&^mask, hi, shift)
+		}
+		lo, hi = nextLo, nextHi
+	}
+	return terms
+}
+
+// NumericRangeQuery matches documents with a numeric field in the range
+// [min, max]. Use math.Inf to leave either end of the range open.
+func NumericRangeQuery(field string, min, max float64) Query {
+	q := &rangeQuery{
+		field: field,
+		lo:    sortableFloat(min),
+		hi:    sortableFloat(max),
+		from:  formatBound(min, math.IsInf(min, -1)),
+		to:    formatBound(max, math.IsInf(max, 1)),
+	}
+	if math.IsNaN(min) || math.IsNaN(max) {
+		q.lo, q.hi = 1, 0
+	}
+	return q
+}
+
+func formatBound(f float64, open bool) string {
+	if open {
+		return "*"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// DateRangeQuery matches documents with a date field in the range
+// [from, to]. A zero time leaves that end of the range open.
+func DateRangeQuery(field string, from, to time.Time) Query {
+	q := &rangeQuery{field: field, lo: 0, hi: math.MaxUint64, from: "*", to: "*"}
+	if !from.IsZero() {
+		q.lo = sortableTime(from)
+		q.from = from.Format(time.RFC3339Nano)
+	}
+	if !to.IsZero() {
+		q.hi = sortableTime(to)
+		q.to = to.Format(time.RFC3339Nano)
+	}
+	return q
+}
+
+type rangeQuery struct {
+	field  string
+	lo, hi uint64
+	// Bounds of the range as they are written in a query
+	from, to string
+}
+
+func (rq *rangeQuery) Keys() []string { return nil }
+
+func (rq *rangeQuery) String() string {
+	return fieldPrefix(rq.field) + "[" + rq.from + " TO " + rq.to + "]"
+}
+
+func (rq *rangeQuery) search(ix *Index) []*posting {
+	terms := splitRange(rq.lo, rq.hi)
+	lists := make([][]*posting, 0, len(terms))
+	for _, t := range terms {
+		if p := ix.postings(fieldKey(rq.field, t)); len(p) > 0 {
+			lists = append(lists, p)
+		}
+	}
+	// The trie terms of a value are not meaningful on their own so the range
+	// is scored as a single term.
+	return asTerm(rq.String(), union(lists))
+}
+
+var _ Query = (*rangeQuery)(nil)
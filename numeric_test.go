@@ -0,0 +1,118 @@
+package ts
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestSortableValues(t *testing.T) {
+	t.Parallel()
+	floats := []float64{math.Inf(-1), -1e300, -2.5, -1, -0.0001, 0, 0.0001, 1, 2.5, 1e300, math.Inf(1)}
+	for i := 1; i < len(floats); i++ {
+		if sortableFloat(floats[i-1]) >= sortableFloat(floats[i]) {
+			t.Errorf("%v should sort before %v", floats[i-1], floats[i])
+		}
+	}
+	times := []time.Time{
+		time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Unix(0, 0),
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 1, 0, 0, 0, 1, time.UTC),
+	}
+	for i := 1; i < len(times); i++ {
+		if sortableTime(times[i-1]) >= sortableTime(times[i]) {
+			t.Errorf("%v should sort before %v", times[i-1], times[i])
+		}
+	}
+}
+
+func TestSplitRange(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(1))
+	check := func(lo, hi uint64, values []uint64) {
+		terms := make(map[string]bool)
+		for _, term := range splitRange(lo, hi) {
+			if terms[term] {
+				t.Fatalf("[%d, %d]: duplicate term %q", lo, hi, term)
+			}
+			terms[term] = true
+		}
+		for _, v := range values {
+			matches := 0
+			for _, term := range trieTerms(v) {
+				if terms[term] {
+					matches++
+				}
+			}
+			in := lo <= v && v <= hi
+			if in && matches != 1 || !in && matches != 0 {
+				t.Fatalf("[%d, %d]: value %d matched %d terms", lo, hi, v, matches)
+			}
+		}
+	}
+	for i := 0; i < 200; i++ {
+		lo := r.Uint64() >> uint(r.Intn(64))
+		hi := lo + r.Uint64()>>uint(r.Intn(64))
+		if hi < lo {
+			hi = math.MaxUint64
+		}
+		values := []uint64{0, lo, hi, math.MaxUint64}
+		if lo > 0 {
+			values = append(values, lo-1)
+		}
+		if hi < math.MaxUint64 {
+			values = append(values, hi+1)
+		}
+		for j := 0; j < 20; j++ {
+			values = append(values, lo+uint64(r.Int63n(int64((hi-lo)>>1|1))))
+		}
+		check(lo, hi, values)
+	}
+	check(0, math.MaxUint64, []uint64{0, 1, math.MaxUint64})
+	check(5, 5, []uint64{4, 5, 6})
+	is.New(t).Equal(len(splitRange(6, 5)), 0)
+}
+
+func TestRangeQueries(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex()
+	date := func(year int) time.Time { return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC) }
+	for _, doc := range []*Document{
+		NewDocument("gfs", NumericField("size", 2.5), DateField("published", date(2003))),
+		NewDocument("raft", NumericField("size", 0.5), DateField("published", date(2014))),
+		NewDocument("bitcoin", NumericField("size", 9), DateField("published", date(2008))),
+		NewDocument("spanner", NumericField("size", -3), DateField("published", date(2012))),
+		NewDocument("dynamo", NumericField("size", 12), DateField("published", date(2007))),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(q Query) []string {
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		sort.Strings(res)
+		return res
+	}
+	is.Equal(names(NumericRangeQuery("size", 1, 10)), []string{"bitcoin", "gfs"})
+	is.Equal(names(NumericRangeQuery("size", 0.5, 2.5)), []string{"gfs", "raft"})
+	is.Equal(names(NumericRangeQuery("size", math.Inf(-1), 0)), []string{"spanner"})
+	is.Equal(names(NumericRangeQuery("size", 9, math.Inf(1))), []string{"bitcoin", "dynamo"})
+	is.Equal(names(NumericRangeQuery("size", 3, 2)), []string{})
+	is.Equal(names(NumericRangeQuery("published", 1, 10)), []string{})
+
+	is.Equal(names(DateRangeQuery("published", date(2008), date(2012))), []string{"bitcoin", "spanner"})
+	is.Equal(names(DateRangeQuery("published", date(2010), time.Time{})), []string{"raft", "spanner"})
+	is.Equal(names(DateRangeQuery("published", time.Time{}, date(2007))), []string{"dynamo", "gfs"})
+	is.Equal(names(And(
+		DateRangeQuery("published", date(2005), time.Time{}),
+		NumericRangeQuery("size", 1, math.Inf(1)),
+	)), []string{"bitcoin", "dynamo"})
+}
@@ -0,0 +1,251 @@
+package ts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+)
+
+// DefaultPageSize is the number of results in a page when a SearchRequest
+// does not set a Size.
+const DefaultPageSize = 10
+
+// SearchRequest asks for a page of the results of a query. Results are
+// ordered by rank, or by the fields given to SortBy in Options, and then by
+// DocID.
+type SearchRequest struct {
+	Query Query
+	// From is the number of results to skip.
+	From int
+	// Size is the number of results in the page, DefaultPageSize if zero.
+	Size int
+	// SearchAfter is the Next token of the previous page. The page starts
+	// after the last result of the previous page and searches the documents
+	// that the first page searched.
+	SearchAfter string
+	// Options are applied to the search as they are by Search.
+	Options []SearchOption
+}
+
+// SearchResponse is a page of search results.
+type SearchResponse struct {
+	Results []*QueryResult
+	// Next is the SearchAfter token of the next page, empty if this is the
+	// last page.
+	Next string
+}
+
+// ErrInvalidCursor is returned for a SearchAfter token that was not made by
+// SearchPage.
+var ErrInvalidCursor = errors.New("ts: invalid search cursor")
+
+// Cursor is the position of a result in the results of a search.
+type Cursor struct {
+	Rank  float64
+	DocID DocID
+	// MaxDocID is the highest document ID when the first page was searched.
+	// Documents added later are left out of the following pages and the
+	// statistics of the query's terms are computed without them, so ranks
+	// are the same on every page. Documents that are deleted between pages
+	// are left out.
+	MaxDocID DocID
+	// Values of the result for the fields the search is sorted by
+	keys []sortKey
+}
+
+const cursorVersion = 1
+
+// String encodes the cursor as a token for SearchRequest.SearchAfter.
+func (c *Cursor) String() string {
+	var buf [1 + 8 + 2*binary.MaxVarintLen64]byte
+	buf[0] = cursorVersion
+	binary.BigEndian.PutUint64(buf[1:], math.Float64bits(c.Rank))
+	n := 9
+	n += binary.PutUvarint(buf[n:], uint64(c.DocID))
+	n += binary.PutUvarint(buf[n:], uint64(c.MaxDocID))
+	b := buf[:n]
+	if len(c.keys) > 0 {
+		b = appendUvarint(b, uint64(len(c.keys)))
+		for _, k := range c.keys {
+			b = append(b, k.kind)
+			switch k.kind {
+			case numberKey:
+				b = appendUvarint(b, k.num)
+			case keywordKey:
+				b = appendUvarint(b, uint64(len(k.str)))
+				b = append(b, k.str...)
+			}
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// ParseCursor decodes a token made by Cursor.String.
+func ParseCursor(token string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) < 9 || b[0] != cursorVersion {
+		return nil, ErrInvalidCursor
+	}
+	c := &Cursor{Rank: math.Float64frombits(binary.BigEndian.Uint64(b[1:9]))}
+	r := bytes.NewReader(b[9:])
+	id, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	maxID, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c.DocID, c.MaxDocID = DocID(id), DocID(maxID)
+	if r.Len() > 0 {
+		if c.keys, err = readSortKeys(r); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	if _, err = r.ReadByte(); err != io.EOF {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func readSortKeys(r *bytes.Reader) ([]sortKey, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n == 0 || n > uint64(r.Len()) {
+		return nil, ErrInvalidCursor
+	}
+	keys := make([]sortKey, n)
+	for i := range keys {
+		if keys[i].kind, err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+		switch keys[i].kind {
+		case missingKey:
+		case numberKey:
+			if keys[i].num, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		case keywordKey:
+			size, err := binary.ReadUvarint(r)
+			if err != nil || size > uint64(r.Len()) {
+				return nil, ErrInvalidCursor
+			}
+			str := make([]byte, size)
+			if _, err = io.ReadFull(r, str); err != nil {
+				return nil, err
+			}
+			keys[i].str = string(str)
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+	return keys, nil
+}
+
+// after returns a filter of the results that come after the cursor in an
+// ordering.
+func (c *Cursor) after(order *ordering) func(*QueryResult) bool {
+	last := &QueryResult{Rank: c.Rank, DocumentID: c.DocID, sortKeys: c.keys}
+	return func(r *QueryResult) bool { return order.worse(r, last) }
+}
+
+// SearchPage returns a page of the results of a search. Only the results up
+// to the end of the page are kept while searching so deep pages do not hold
+// every result in memory, and pages fetched with SearchAfter are consistent
+// while new documents are added.
+func (ix *Index) SearchPage(req *SearchRequest) (*SearchResponse, error) {
+	var (
+		size = req.Size
+		from = atLeast(req.From, 0)
+		so   = newSearchOptions(req.Options)
+		cur  *Cursor
+		err  error
+	)
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if req.SearchAfter != "" {
+		if cur, err = ParseCursor(req.SearchAfter); err != nil {
+			return nil, err
+		}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if len(ix.docNames) == 0 {
+		return &SearchResponse{}, nil
+	}
+	order := ix.newOrdering(so)
+	if cur == nil {
+		cur = &Cursor{MaxDocID: DocID(len(ix.docNames) - 1), Rank: math.Inf(1)}
+	} else if len(cur.keys) != len(so.sort) {
+		return nil, ErrInvalidCursor
+	} else {
+		so.accept = cur.after(order)
+	}
+	so.snapshot = &cur.MaxDocID
+
+	result := ix.searchTopK(req.Query, from+size, so)
+	if from >= len(result) {
+		return &SearchResponse{}, nil
+	}
+	resp := &SearchResponse{Results: result[from:]}
+	ix.decorate(req.Query, resp.Results, so)
+	if len(resp.Results) == size {
+		last := resp.Results[size-1]
+		next := Cursor{Rank: last.Rank, DocID: last.DocumentID, MaxDocID: cur.MaxDocID, keys: last.sortKeys}
+		resp.Next = next.String()
+	}
+	return resp, nil
+}
+
+// liveAfter returns the number of live documents with an ID greater than id
+// and their total length.
+func (ix *Index) liveAfter(id DocID) (docs int, length float64) {
+	for i := id + 1; i < DocID(len(ix.docNames)); i++ {
+		if !ix.isDeleted(i) {
+			docs++
+			length += ix.documentLength[i]
+		}
+	}
+	return docs, length
+}
+
+// docFreqAfter returns the number of live documents containing a key with an
+// ID greater than id.
+func (ix *Index) docFreqAfter(key string, id DocID) int {
+	n := 0
+	count := func(seg *segment) {
+		t, ok := seg.terms[key]
+		if !ok || seg.maxID <= id {
+			return
+		}
+		for _, p := range t.postings[sort.Search(len(t.postings), func(i int) bool {
+			return t.postings[i].ID > id
+		}):] {
+			if !ix.isDeleted(p.ID) {
+				n++
+			}
+		}
+	}
+	for _, seg := range ix.segments {
+		count(seg)
+	}
+	count(ix.mem)
+	return n
+}
+
+// upTo returns the postings with an ID of at most id.
+func upTo(postings []*posting, id DocID) []*posting {
+	return postings[:sort.Search(len(postings), func(i int) bool {
+		return postings[i].ID > id
+	})]
+}
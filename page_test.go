@@ -0,0 +1,149 @@
+package ts
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestSearchPage(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(40))
+	r := rand.New(rand.NewSource(2))
+	add := func(n int) {
+		for i := 0; i < n; i++ {
+			_, err := ix.AddDocument(fmt.Sprintf("doc%d", len(ix.docNames)), strings.NewReader(zipfText(r, 5+r.Intn(40))))
+			is.NoErr(err)
+		}
+	}
+	add(300)
+	ids := func(res []*QueryResult) []DocID {
+		out := make([]DocID, len(res))
+		for i, r := range res {
+			out[i] = r.DocumentID
+		}
+		return out
+	}
+
+	for _, q := range []Query{Or("w0", "w3"), And(StringQuery("w0"), StringQuery("w1")), PhraseQuery(DefaultField, "w0 w0")} {
+		all := ix.SearchTopK(q, 1<<20)
+		is.True(len(all) > 20)
+
+		// Pages made with From are slices of the full results.
+		resp, err := ix.SearchPage(&SearchRequest{Query: q, From: 5, Size: 7})
+		is.NoErr(err)
+		is.Equal(ids(resp.Results), ids(all[5:12]))
+
+		// Pages made with SearchAfter list every result once while new
+		// documents are added and old ones deleted.
+		var (
+			seen []*QueryResult
+			req  = &SearchRequest{Query: q, Size: 6}
+		)
+		for page := 0; ; page++ {
+			resp, err := ix.SearchPage(req)
+			is.NoErr(err)
+			seen = append(seen, resp.Results...)
+			if resp.Next == "" {
+				is.True(len(resp.Results) < 6)
+				break
+			}
+			is.Equal(len(resp.Results), 6)
+			req.SearchAfter = resp.Next
+			add(3)
+		}
+		is.Equal(ids(seen), ids(all))
+		for i := range seen {
+			is.Equal(seen[i].Rank, all[i].Rank)
+		}
+	}
+
+	// Deleted documents drop out of later pages without repeating results.
+	q := StringQuery("w0")
+	first, err := ix.SearchPage(&SearchRequest{Query: q, Size: 5})
+	is.NoErr(err)
+	before := ix.SearchTopK(q, 20)
+	is.NoErr(ix.Delete(before[7].DocumentID))
+	second, err := ix.SearchPage(&SearchRequest{Query: q, Size: 5, SearchAfter: first.Next})
+	is.NoErr(err)
+	is.Equal(ids(second.Results), append(ids(before[5:7]), ids(before[8:11])...))
+
+	resp, err := ix.SearchPage(&SearchRequest{Query: q, From: 100000})
+	is.NoErr(err)
+	is.Equal(len(resp.Results), 0)
+	is.Equal(resp.Next, "")
+	resp, err = ix.SearchPage(&SearchRequest{Query: q})
+	is.NoErr(err)
+	is.Equal(len(resp.Results), DefaultPageSize)
+}
+
+func TestSearchPageDisjunction(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	terms := make([]string, 8)
+	for i := range terms {
+		terms[i] = fmt.Sprint("w", i)
+	}
+	q := Or(terms...)
+	for seed := int64(0); seed < 5; seed++ {
+		ix := NewIndex(WithFlushThreshold(30))
+		r := rand.New(rand.NewSource(seed))
+		for i := 0; i < 400; i++ {
+			_, err := ix.AddDocument(fmt.Sprint(i), strings.NewReader(zipfText(r, 5+r.Intn(40))))
+			is.NoErr(err)
+		}
+		for _, scorer := range []Scorer{TFIDF{}, NewBM25(), VectorSpace{}} {
+			// Pages are searched with WAND, which collects the terms of a
+			// document in a different order on every page, so ranks must
+			// not depend on that order for the cursor to find its result.
+			all := ix.SearchTopK(q, 1<<20, ScoreWith(scorer))
+			var (
+				seen = make(map[DocID]bool)
+				n    int
+				req  = &SearchRequest{Query: q, Size: 7, Options: []SearchOption{ScoreWith(scorer)}}
+			)
+			for {
+				resp, err := ix.SearchPage(req)
+				is.NoErr(err)
+				for _, res := range resp.Results {
+					is.True(!seen[res.DocumentID]) // no duplicates
+					seen[res.DocumentID] = true
+					is.Equal(res.Rank, all[n].Rank)
+					n++
+				}
+				if resp.Next == "" {
+					break
+				}
+				req.SearchAfter = resp.Next
+			}
+			is.Equal(n, len(all))
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	for _, c := range []Cursor{
+		{},
+		{Rank: 3.25, DocID: 42, MaxDocID: 1 << 40},
+		{Rank: -0.5, DocID: 1<<64 - 1, MaxDocID: 7},
+		{Rank: 1, DocID: 2, MaxDocID: 3, keys: []sortKey{{kind: numberKey, num: 1 << 63}, {}, {kind: keywordKey, str: "raft"}}},
+	} {
+		got, err := ParseCursor(c.String())
+		is.NoErr(err)
+		is.Equal(*got, c)
+	}
+	valid := (&Cursor{Rank: 1, DocID: 2, MaxDocID: 3}).String()
+	sorted := (&Cursor{Rank: 1, DocID: 2, MaxDocID: 3, keys: []sortKey{{kind: keywordKey, str: "raft"}}}).String()
+	for _, token := range []string{"x", "!!!", valid[:len(valid)-1], valid + "AA", "AgAAAAAAAAAAAAA", sorted[:len(sorted)-2]} {
+		_, err := ParseCursor(token)
+		is.Equal(err, ErrInvalidCursor)
+	}
+	_, err := NewIndex().SearchPage(&SearchRequest{Query: StringQuery("a"), SearchAfter: "x"})
+	is.Equal(err, ErrInvalidCursor)
+}
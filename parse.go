@@ -0,0 +1,612 @@
+package ts
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ParseQuery parses a query written in a syntax similar to Lucene's:
+//
+//	raft              a term in the DefaultField
+//	title:raft        a term in another field, *:raft searches every field
+//	+raft -paxos      a term that must or must not match, NOT paxos is -paxos
+//	#raft             a term that must match without adding to the score
+//	a AND b, a OR b   both terms must match, either term may match
+//	"leader election" a phrase, "leader election"~2 allows a slop of 2
+//	NEAR/3(a b)       terms within 3 positions of each other
+//	dist*, r?ft       a prefix or a wildcard pattern
+//	raft~1, dist*~1   a fuzzy term or a fuzzy prefix within 1 edit
+//	/rpc_[a-z]+/      a regular expression
+//	size:[1 TO 10]    a numeric or date range, * leaves an end open
+//	title:(a b)       a group of clauses, in a field if one is given
+//	(a b c)~2         a group where at least 2 optional clauses must match
+//	consensus^2 paxos a clause boosted to count twice as much as others
+//
+// Clauses without an operator are optional unless the group has no required
+// clauses, in which case at least one of them must match. A group with only
+// excluded clauses matches every document they do not. Special characters
+// can be escaped with a backslash. Malformed queries return a *SyntaxError.
+//
+// The String method of a query returns it in this syntax so that it can be
+// parsed again.
+func ParseQuery(query string) (Query, error) {
+	p := &parser{input: []rune(query)}
+	q, err := p.parseClauses(DefaultField, -1)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// SyntaxError describes a malformed query.
+type SyntaxError struct {
+	// Column is the position of the error in characters starting at 1.
+	Column int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("ts: syntax error at column %d: %s", e.Column, e.Msg)
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Column: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.input) }
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.input[p.pos:]), s)
+}
+
+// keyword consumes an operator if it is at the current position.
+func (p *parser) keyword(word string) bool {
+	end := p.pos + len(word)
+	if !p.hasPrefix(word) {
+		return false
+	}
+	if end < len(p.input) && !unicode.IsSpace(p.input[end]) && !strings.ContainsRune(`("]`, p.input[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// occur is how a clause of a group is combined with the other clauses.
+type occur uint8
+
+const (
+	should occur = iota
+	must
+	mustNot
+	filter
+)
+
+type clause struct {
+	occur occur
+	query Query
+}
+
+// parseClauses parses clauses until the end of the input or, when the
+// clauses are in a group opened at paren, until the closing parenthesis.
+func (p *parser) parseClauses(field string, paren int) (Query, error) {
+	var (
+		clauses []clause
+		next    = should
+		// Position of an AND or OR waiting for a clause, -1 if there is none
+		op = -1
+		// Minimum number of optional clauses to match, 0 if not given
+		minShould int
+	)
+	for {
+		p.skipSpace()
+		if p.eof() {
+			if paren >= 0 {
+				return nil, p.errorf(paren, "missing )")
+			}
+			break
+		}
+		if p.peek() == ')' {
+			if paren < 0 {
+				return nil, p.errorf(p.pos, "unexpected )")
+			}
+			p.pos++
+			var err error
+			if minShould, err = p.readMinShould(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		start := p.pos
+		if p.keyword("AND") || p.keyword("OR") {
+			if len(clauses) == 0 || op >= 0 {
+				return nil, p.errorf(start, "%s must be between two clauses", string(p.input[start:p.pos]))
+			}
+			next = should
+			if p.input[start] == 'A' {
+				if last := &clauses[len(clauses)-1]; last.occur == should {
+					last.occur = must
+				}
+				next = must
+			}
+			op = start
+			continue
+		}
+		occ := next
+		switch {
+		case p.peek() == '+':
+			p.pos++
+			occ = must
+		case p.peek() == '#':
+			p.pos++
+			occ = filter
+		case p.peek() == '-':
+			p.pos++
+			occ = mustNot
+		case p.keyword("NOT"):
+			occ = mustNot
+		}
+		q, err := p.parsePrimary(field)
+		if err != nil {
+			return nil, err
+		}
+		if q, err = p.readBoost(q); err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause{occur: occ, query: q})
+		next, op = should, -1
+	}
+	if op >= 0 {
+		return nil, p.errorf(op, "%s must be between two clauses", string(p.input[op:op+2]))
+	}
+	switch {
+	case len(clauses) == 0 && paren >= 0:
+		return nil, p.errorf(paren, "empty group")
+	case len(clauses) == 0:
+		return nil, p.errorf(p.pos, "empty query")
+	case len(clauses) == 1 && clauses[0].occur == should && minShould == 0:
+		return clauses[0].query, nil
+	}
+	bq := &BoolQuery{MinimumShouldMatch: minShould}
+	for _, c := range clauses {
+		switch c.occur {
+		case must:
+			bq.Must = append(bq.Must, c.query)
+		case mustNot:
+			bq.MustNot = append(bq.MustNot, c.query)
+		case filter:
+			bq.Filter = append(bq.Filter, c.query)
+		default:
+			bq.Should = append(bq.Should, c.query)
+		}
+	}
+	return bq, nil
+}
+
+// readBoost boosts a clause by the number after a '^'.
+func (p *parser) readBoost(q Query) (Query, error) {
+	for p.peek() == '^' {
+		p.pos++
+		start := p.pos
+		for !p.eof() && strings.ContainsRune("0123456789.eE+-", p.peek()) {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(string(p.input[start:p.pos]), 64)
+		if err != nil || f <= 0 || math.IsInf(f, 0) {
+			return nil, p.errorf(start, "expected a positive boost after ^")
+		}
+		q = Boost(q, f)
+	}
+	return q, nil
+}
+
+// readMinShould reads the ~N after a group. It returns 0 if there is no '~'.
+func (p *parser) readMinShould() (int, error) {
+	if p.peek() != '~' {
+		return 0, nil
+	}
+	p.pos++
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for !p.eof() && unicode.IsDigit(p.peek()) {
+		p.pos++
+	}
+	n, err := strconv.Atoi(string(p.input[start:p.pos]))
+	if err != nil {
+		return 0, p.errorf(start, "expected the number of clauses to match after ~")
+	}
+	return n, nil
+}
+
+func (p *parser) parsePrimary(field string) (Query, error) {
+	p.skipSpace()
+	if p.eof() || p.peek() == ')' {
+		return nil, p.errorf(p.pos, "expected a clause")
+	}
+	switch p.peek() {
+	case '(':
+		p.pos++
+		return p.parseClauses(field, p.pos-1)
+	case '"':
+		return p.parsePhrase(field)
+	case '/':
+		return p.parseRegexp(field)
+	case '[':
+		return p.parseRange(field)
+	}
+	if p.hasPrefix("NEAR/") {
+		return p.parseNear(field)
+	}
+	start := p.pos
+	text, wild, err := p.readTerm()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == ':' {
+		if text == "" {
+			return nil, p.errorf(start, "missing field name")
+		}
+		if wild && text != "*" {
+			return nil, p.errorf(start, "invalid field name %q", text)
+		}
+		p.pos++
+		if p.eof() || unicode.IsSpace(p.peek()) {
+			return nil, p.errorf(p.pos, "expected a clause after %s:", text)
+		}
+		return p.parsePrimary(text)
+	}
+	if text == "" {
+		return nil, p.errorf(start, "unexpected %q", p.peek())
+	}
+	return p.termQuery(field, text, wild, start)
+}
+
+// readTerm reads a term up to the next space or special character and
+// reports whether it has unescaped wildcards.
+func (p *parser) readTerm() (string, bool, error) {
+	var (
+		b    strings.Builder
+		wild bool
+	)
+	for !p.eof() {
+		c := p.peek()
+		if c == '\\' {
+			p.pos++
+			if p.eof() {
+				return "", false, p.errorf(p.pos-1, "escape at end of query")
+			}
+			b.WriteRune(p.input[p.pos])
+			p.pos++
+			continue
+		}
+		if unicode.IsSpace(c) || strings.ContainsRune(`()":~^`, c) {
+			break
+		}
+		if c == '*' || c == '?' {
+			wild = true
+		}
+		b.WriteRune(c)
+		p.pos++
+	}
+	return b.String(), wild, nil
+}
+
+// readSuffix reads the number after a '~', which defaults to 2. It returns
+// -1 if there is no '~'.
+func (p *parser) readSuffix() (int, error) {
+	if p.peek() != '~' {
+		return -1, nil
+	}
+	p.pos++
+	start := p.pos
+	for !p.eof() && unicode.IsDigit(p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		return 2, nil
+	}
+	n, err := strconv.Atoi(string(p.input[start:p.pos]))
+	if err != nil {
+		return 0, p.errorf(start, "invalid number %q", string(p.input[start:p.pos]))
+	}
+	return n, nil
+}
+
+func (p *parser) termQuery(field, text string, wild bool, start int) (Query, error) {
+	edits, err := p.readSuffix()
+	if err != nil {
+		return nil, err
+	}
+	if field == "*" {
+		if wild || edits >= 0 {
+			return nil, p.errorf(start, "only plain terms can search every field")
+		}
+		return AnyFieldQuery(text), nil
+	}
+	isPrefix := wild && strings.IndexAny(text, "*?") == len(text)-1 && text[len(text)-1] == '*'
+	switch {
+	case isPrefix && edits >= 0:
+		return &fuzzyQuery{
+			field:         field,
+			token:         string(cleanWord(text[:len(text)-1])),
+			maxEdits:      edits,
+			prefix:        true,
+			maxExpansions: DefaultMaxExpansions,
+		}, nil
+	case wild && edits >= 0:
+		return nil, p.errorf(start, "fuzzy wildcards must be a prefix such as dist*~1")
+	case isPrefix:
+		return &prefixQuery{
+			field:         field,
+			prefix:        string(cleanWord(text[:len(text)-1])),
+			maxExpansions: DefaultMaxExpansions,
+		}, nil
+	case wild:
+		q := WildcardQuery(text, 0).(*wildcardQuery)
+		q.field = field
+		return q, nil
+	}
+	if edits < 0 {
+		// Terms are analyzed by their field's analyzer when they are
+		// searched.
+		return &fieldQuery{field: field, text: text}, nil
+	}
+	token := string(cleanWord(text))
+	if token == "" {
+		return nil, p.errorf(start, "%q has no searchable text", text)
+	}
+	return &fuzzyQuery{
+		field:         field,
+		token:         token,
+		maxEdits:      edits,
+		maxExpansions: DefaultMaxExpansions,
+	}, nil
+}
+
+// readDelimited reads text up to an unescaped closing delimiter. Escaped
+// delimiters are unescaped, as are backslashes in phrases. Other escapes are
+// kept so that regular expressions are read as they were written.
+func (p *parser) readDelimited(delim rune, what string) (string, error) {
+	var (
+		b     strings.Builder
+		start = p.pos
+	)
+	p.pos++
+	for {
+		if p.eof() {
+			return "", p.errorf(start, "unterminated %s", what)
+		}
+		c := p.input[p.pos]
+		p.pos++
+		switch {
+		case c == delim:
+			return b.String(), nil
+		case c == '\\' && !p.eof():
+			if next := p.peek(); next != delim && (delim != '"' || next != '\\') {
+				b.WriteRune(c)
+			}
+			b.WriteRune(p.input[p.pos])
+			p.pos++
+		default:
+			b.WriteRune(c)
+		}
+	}
+}
+
+func (p *parser) parsePhrase(field string) (Query, error) {
+	start := p.pos
+	phrase, err := p.readDelimited('"', "phrase")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(phrase) == "" {
+		return nil, p.errorf(start, "empty phrase")
+	}
+	slop, err := p.readSuffix()
+	if err != nil {
+		return nil, err
+	}
+	if field == "*" {
+		return nil, p.errorf(start, "only plain terms can search every field")
+	}
+	return SloppyPhraseQuery(field, phrase, slop), nil
+}
+
+func (p *parser) parseRegexp(field string) (Query, error) {
+	start := p.pos
+	expr, err := p.readDelimited('/', "regular expression")
+	if err != nil {
+		return nil, err
+	}
+	q, err := RegexpQuery(expr, 0)
+	if err != nil {
+		return nil, p.errorf(start+1, "%v", err)
+	}
+	if field == "*" {
+		return nil, p.errorf(start, "only plain terms can search every field")
+	}
+	q.(*regexpQuery).field = field
+	return q, nil
+}
+
+func (p *parser) parseRange(field string) (Query, error) {
+	start := p.pos
+	p.pos++
+	bound := func() (string, int) {
+		p.skipSpace()
+		from := p.pos
+		for !p.eof() && !unicode.IsSpace(p.peek()) && p.peek() != ']' {
+			p.pos++
+		}
+		return string(p.input[from:p.pos]), from
+	}
+	lo, loPos := bound()
+	if lo == "" {
+		return nil, p.errorf(loPos, "expected a range bound")
+	}
+	p.skipSpace()
+	if !p.keyword("TO") {
+		return nil, p.errorf(p.pos, "expected TO")
+	}
+	hi, hiPos := bound()
+	if hi == "" {
+		return nil, p.errorf(hiPos, "expected a range bound")
+	}
+	p.skipSpace()
+	if p.peek() != ']' {
+		return nil, p.errorf(start, "missing ]")
+	}
+	p.pos++
+	if field == "*" {
+		return nil, p.errorf(start, "only plain terms can search every field")
+	}
+	if lo == "*" && hi == "*" {
+		return &rangeQuery{field: field, lo: 0, hi: math.MaxUint64, from: "*", to: "*"}, nil
+	}
+	// An open bound could be a number or a date, so the other bound decides.
+	kind := lo
+	if lo == "*" {
+		kind = hi
+	}
+	if _, err := strconv.ParseFloat(kind, 64); err == nil {
+		min, _ := parseNumericBound(lo, math.Inf(-1))
+		max, ok := parseNumericBound(hi, math.Inf(1))
+		if !ok {
+			return nil, p.errorf(hiPos, "invalid number %q", hi)
+		}
+		return NumericRangeQuery(field, min, max), nil
+	}
+	from, ok := parseDateBound(lo)
+	if !ok {
+		return nil, p.errorf(loPos, "invalid range bound %q", lo)
+	}
+	to, ok := parseDateBound(hi)
+	if !ok {
+		return nil, p.errorf(hiPos, "invalid date %q", hi)
+	}
+	return DateRangeQuery(field, from, to), nil
+}
+
+func parseNumericBound(s string, open float64) (float64, bool) {
+	if s == "*" {
+		return open, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func parseDateBound(s string) (time.Time, bool) {
+	if s == "*" {
+		return time.Time{}, true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (p *parser) parseNear(field string) (Query, error) {
+	start := p.pos
+	p.pos += len("NEAR/")
+	from := p.pos
+	for !p.eof() && unicode.IsDigit(p.peek()) {
+		p.pos++
+	}
+	k, err := strconv.Atoi(string(p.input[from:p.pos]))
+	if err != nil {
+		return nil, p.errorf(from, "expected a distance after NEAR/")
+	}
+	if p.peek() != '(' {
+		return nil, p.errorf(p.pos, "expected ( after NEAR/%d", k)
+	}
+	p.pos++
+	q := &nearQuery{field: field, k: k}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf(start, "missing )")
+		}
+		if p.peek() == ')' {
+			p.pos++
+			break
+		}
+		termPos := p.pos
+		text, wild, err := p.readTerm()
+		if err != nil {
+			return nil, err
+		}
+		token := string(cleanWord(text))
+		if wild || token == "" {
+			return nil, p.errorf(termPos, "NEAR only accepts plain terms")
+		}
+		q.terms = append(q.terms, token)
+	}
+	if len(q.terms) == 0 {
+		return nil, p.errorf(start, "NEAR needs at least one term")
+	}
+	if field == "*" {
+		return nil, p.errorf(start, "only plain terms can search every field")
+	}
+	return q, nil
+}
+
+// escape adds backslashes before the characters of s that have a meaning in
+// the query syntax, except for the characters in keep.
+func escape(s, keep string) string {
+	var b strings.Builder
+	for i, c := range s {
+		special := unicode.IsSpace(c) || strings.ContainsRune(`\():^"~*?`, c) ||
+			i == 0 && strings.ContainsRune(`+-#/[`, c)
+		if special && !strings.ContainsRune(keep, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	s = b.String()
+	// Terms that look like operators are escaped so they are read as terms.
+	switch {
+	case s == "AND", s == "OR", s == "NOT", s == "TO", strings.HasPrefix(s, "NEAR/"):
+		s = `\` + s
+	}
+	return s
+}
+
+func escapeTerm(s string) string { return escape(s, "") }
+
+// fieldPrefix returns the prefix that names a field in a query.
+func fieldPrefix(field string) string {
+	if field == DefaultField {
+		return ""
+	}
+	return escapeTerm(field) + ":"
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,207 @@
+package ts
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestParseQuery(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct{ input, canonical string }{
+		{"raft", "raft"},
+		{"  Raft. ", "Raft."},
+		{"+raft -paxos", "(+raft -paxos)"},
+		{`+raft -paxos "leader election" title:consensus dist*~1 (a OR b)`,
+			`(+raft "leader election" title:consensus dist*~1 (a b) -paxos)`},
+		{"a AND b OR c", "(+a +b c)"},
+		{"a OR b AND NOT c", "(+b a -c)"},
+		{"NOT(a b)", "(-(a b))"},
+		{"title:(a +b)", "(+title:b title:a)"},
+		{`"leader election"~2`, `"leader election"~2`},
+		{`title:"say \"hi\""`, `title:"say \"hi\""`},
+		{"NEAR/3(leader Election)", "NEAR/3(leader election)"},
+		{"raft~", "raft~2"},
+		{"raft~1 distrib*", "(raft~1 distrib*)"},
+		{"r?ft *raft", "(r?ft *raft)"},
+		{`/rpc_[a-z]+\/x/`, `/rpc_[a-z]+\/x/`},
+		{"size:[1 TO *]", "size:[1 TO *]"},
+		{"size:[* TO 2.5] date:[2008-01-01 TO *]", "(size:[* TO 2.5] date:[2008-01-01T00:00:00Z TO *])"},
+		{"size:[* TO *]", "size:[* TO *]"},
+		{"date:[* TO 2008-01-01]", "date:[* TO 2008-01-01T00:00:00Z]"},
+		{"size:[* TO -1]", "size:[* TO -1]"},
+		{"*:raft", "*:raft"},
+		{`c\+\+ \-1`, `(c++ \-1)`},
+		{"(((raft)))", "raft"},
+		{"+(+a)", "(+(+a))"},
+		{"#raft paxos", "(#raft paxos)"},
+		{"(a b c)~2", "(a b c)~2"},
+		{"(a)~1 +(b c)~-1", "(+(b c)~-1 (a)~1)"},
+		{`\#tag`, `\#tag`},
+		{"consensus^2 protocol", "(consensus^2 protocol)"},
+		{`+title:raft^1.5 "leader election"~1^3 (a b)~1^2`, `(+title:raft^1.5 "leader election"~1^3 (a b)~1^2)`},
+		{"a^2^3", "a^2^3"},
+	} {
+		q, err := ParseQuery(tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		if s := q.String(); s != tc.canonical {
+			t.Errorf("%s: got %s, want %s", tc.input, s, tc.canonical)
+			continue
+		}
+		q, err = ParseQuery(tc.canonical)
+		if err != nil {
+			t.Errorf("%s: %v", tc.canonical, err)
+		} else if s := q.String(); s != tc.canonical {
+			t.Errorf("%s: round trip gave %s", tc.canonical, s)
+		}
+	}
+	for _, q := range []Query{
+		And(StringQuery("a"), Or("b", "c")),
+		QueryTree(FieldQuery("title", "raft"), PhraseQuery(DefaultField, "leader election")),
+		Near(2, "leader", "election"),
+		NumericRangeQuery("size", 1, 2),
+		FuzzyQuery("raft", 1, 0),
+		PrefixQuery("dist", 0),
+		WildcardQuery("r*ft", 0),
+		DateRangeQuery("published", time.Time{}, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		DateRangeQuery("published", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}),
+		KeywordQuery("cat", "Papers"),
+		KeywordQuery("cat", "Papers Two"),
+	} {
+		parsed, err := ParseQuery(q.String())
+		if err != nil {
+			t.Errorf("%s: %v", q, err)
+		} else if parsed.String() != q.String() {
+			t.Errorf("%s: round trip gave %s", q, parsed)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		input  string
+		column int
+	}{
+		{"", 1},
+		{"  ", 3},
+		{"a )", 3},
+		{"(a b", 1},
+		{"a (b (c)", 3},
+		{"()", 1},
+		{"AND a", 1},
+		{"a AND", 3},
+		{"a OR OR b", 6},
+		{`a "leader election`, 3},
+		{"title:", 7},
+		{"+", 2},
+		{"a ^2", 3},
+		{"/rpc_(/", 2},
+		{"size:[1 TO]", 11},
+		{"size:[1 2]", 9},
+		{"size:[1 TO x]", 12},
+		{"size:[* TO x]", 12},
+		{"NEAR/(a)", 6},
+		{"NEAR/2(a", 1},
+		{"dist?x~1", 1},
+		{"(a b)~x", 7},
+		{"a^", 3},
+		{"a^0", 3},
+		{"a^-1 b", 3},
+		{`a\`, 2},
+		{"*:a*", 3},
+	} {
+		_, err := ParseQuery(tc.input)
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: expected a syntax error, got %v", tc.input, err)
+			continue
+		}
+		if serr.Column != tc.column {
+			t.Errorf("%q: error at column %d, want %d: %v", tc.input, serr.Column, tc.column, err)
+		}
+	}
+}
+
+func TestParsedQuerySearch(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex()
+	for _, doc := range []*Document{
+		NewDocument("raft", TextField("title", "In Search of an Understandable Consensus Algorithm"),
+			TextField(DefaultField, "raft implements leader election and log replication")),
+		NewDocument("paxos", TextField("title", "Paxos Made Simple"),
+			TextField(DefaultField, "paxos and raft both handle leader election")),
+		NewDocument("zab", TextField("title", "Zab: broadcast for primary-backup systems"),
+			TextField(DefaultField, "zab elects a leader before any election of values")),
+		NewDocument("gfs", TextField("title", "The Google File System"),
+			TextField(DefaultField, "a distributed file system"), KeywordField("cat", "Papers Two")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(query string) []string {
+		q, err := ParseQuery(query)
+		is.NoErr(err)
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		sort.Strings(res)
+		return res
+	}
+	is.Equal(names(`+raft -paxos`), []string{"raft"})
+	is.Equal(names(`"leader election"`), []string{"paxos", "raft"})
+	is.Equal(names(`leader AND election -title:paxos`), []string{"raft", "zab"})
+	is.Equal(names(`title:consensus distrib*~1`), []string{"gfs", "raft"})
+	is.Equal(names(`+leader +(zab OR gfs)`), []string{"zab"})
+	is.Equal(names(`+election raft`), []string{"paxos", "raft", "zab"})
+	is.Equal(names(`-raft`), []string{"gfs", "zab"})
+	is.Equal(names(`title:(simple OR google)`), []string{"gfs", "paxos"})
+	is.Equal(names(`*:consensus`), []string{"raft"})
+	is.Equal(names(`cat:Papers\ Two`), []string{"gfs"})
+	is.Equal(names(KeywordQuery("cat", "Papers Two").String()), []string{"gfs"})
+	is.Equal(names(`cat:papers\ two`), []string{})
+
+	res := ix.Search(mustParse(t, "+election raft"))
+	is.Equal(res[2].DocumentName, "zab") // optional clauses add to the score
+	is.Equal(escapeTerm("AND"), `\AND`)
+}
+
+func TestBoundedPrefixLevenshtein(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		s, t string
+		max  int
+		dist int
+		ok   bool
+	}{
+		{"dist", "distributed", 0, 0, true},
+		{"dsit", "distributed", 1, 0, false},
+		{"dsit", "distributed", 2, 2, true},
+		{"distr", "distributed", 1, 0, true},
+		{"dist", "dust", 1, 1, true},
+		{"dist", "di", 1, 0, false},
+		{"dist", "dis", 1, 1, true},
+		{"", "anything", 0, 0, true},
+	} {
+		d, ok := boundedPrefixLevenshtein([]rune(tc.s), []rune(tc.t), tc.max)
+		if ok != tc.ok || ok && d != tc.dist {
+			t.Errorf("%q, %q within %d: got %d, %v", tc.s, tc.t, tc.max, d, ok)
+		}
+	}
+}
+
+func mustParse(t *testing.T, query string) Query {
+	t.Helper()
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
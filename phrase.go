@@ -0,0 +1,278 @@
+package ts
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PhraseQuery matches documents containing the words of a phrase next to
+// each other and in the same order in a field. The phrase is analyzed with
+// the field's analyzer so removed stop words still have to be skipped over.
+func PhraseQuery(field, phrase string) Query {
+	return SloppyPhraseQuery(field, phrase, 0)
+}
+
+// SloppyPhraseQuery is a PhraseQuery that allows the words of the phrase to
+// be moved up to slop positions away from where they are in the phrase. Two
+// words that are swapped need a slop of 2.
+func SloppyPhraseQuery(field, phrase string, slop int) Query {
+	if slop < 0 {
+		slop = 0
+	}
+	return &phraseQuery{field: field, phrase: phrase, slop: slop}
+}
+
+type phraseQuery struct {
+	field, phrase string
+	slop          int
+}
+
+func (pq *phraseQuery) String() string {
+	s := fieldPrefix(pq.field) + quote(pq.phrase)
+	if pq.slop > 0 {
+		s += "~" + strconv.Itoa(pq.slop)
+	}
+	return s
+}
+
+// Keys returns the words of the phrase split by the default tokenizer. The
+// index analyzes the phrase with the field's analyzer when it searches or
+// highlights it.
+func (pq *phraseQuery) Keys() []string {
+	return tokenTexts(readAllTokens(newCustomTokenizer(strings.NewReader(pq.phrase))))
+}
+
+// analyze returns the tokens of the phrase made by the field's analyzer.
+func (pq *phraseQuery) analyze(ix *Index) ([]Token, error) {
+	tokens, err := ix.analyzerFor(Field{Name: pq.field}).Analyze(strings.NewReader(pq.phrase))
+	if err != nil {
+		return nil, err
+	}
+	return readAllTokens(tokens)
+}
+
+func (pq *phraseQuery) search(ix *Index) []*posting {
+	terms, err := pq.analyze(ix)
+	if err != nil || len(terms) == 0 {
+		return nil
+	}
+	var (
+		lists   = make([][]*posting, len(terms))
+		offsets = make([]int, len(terms))
+		result  []*posting
+	)
+	for i, t := range terms {
+		if lists[i] = ix.postings(fieldKey(pq.field, t.Text)); len(lists[i]) == 0 {
+			return nil
+		}
+		offsets[i] = int(t.Pos) - int(terms[0].Pos)
+	}
+	intersectEach(lists, func(ps []*posting) {
+		var pos []uint
+		if pq.slop == 0 {
+			pos = exactPhrase(ps, offsets)
+		} else {
+			pos = sloppyPhrase(ps, offsets, pq.slop)
+		}
+		if len(pos) > 0 {
+			result = append(result, &posting{ID: ps[0].ID, Pos: pos})
+		}
+	})
+	// The phrase is scored as a single term found in the documents that
+	// contain it.
+	return asTerm(pq.String(), result)
+}
+
+// exactPhrase returns the positions that a phrase starts at in a document.
+// Each term i of the phrase must be found offsets[i] positions after the
+// first term.
+func exactPhrase(ps []*posting, offsets []int) []uint {
+	var res []uint
+Start:
+	for _, start := range ps[0].Pos {
+		for i := 1; i < len(ps); i++ {
+			if !containsPos(ps[i].Pos, int(start)+offsets[i]) {
+				continue Start
+			}
+		}
+		res = append(res, start)
+	}
+	return res
+}
+
+// sloppyPhrase returns the positions of the matches of a phrase where the
+// terms are at most slop positions away from where they should be relative
+// to each other.
+func sloppyPhrase(ps []*posting, offsets []int, slop int) []uint {
+	var res []uint
+	windows(ps, offsets, slop, func(start uint, spread int) {
+		if len(res) == 0 || res[len(res)-1] != start {
+			res = append(res, start)
+		}
+	})
+	return res
+}
+
+// windows calls fn with the start of every window of positions where each
+// term is found within slop positions of where it should be. Each term's
+// positions are shifted back by its offset so that an exact match has every
+// term at the same shifted position. The spread of a window is the distance
+// between its smallest and largest shifted positions.
+func windows(ps []*posting, offsets []int, slop int, fn func(start uint, spread int)) {
+	iters := make([]int, len(ps))
+	for {
+		lo, hi, behind := 0, 0, -1
+		for i, p := range ps {
+			shifted := int(p.Pos[iters[i]]) - offsets[i]
+			if behind < 0 || shifted < lo {
+				lo, behind = shifted, i
+			}
+			if i == 0 || shifted > hi {
+				hi = shifted
+			}
+		}
+		next := behind
+		if i, j, ok := samePos(ps, iters); ok {
+			// A repeated term cannot match the same word twice. The copy
+			// that should be further along the phrase is moved forward,
+			// moving the term furthest behind could skip past a match.
+			next = i
+			if offsets[j] > offsets[i] {
+				next = j
+			}
+		} else if hi-lo <= slop {
+			start := ps[0].Pos[iters[0]]
+			for i, p := range ps {
+				if pos := p.Pos[iters[i]]; pos < start {
+					start = pos
+				}
+			}
+			fn(start, hi-lo)
+		}
+		if iters[next]++; iters[next] >= len(ps[next].Pos) {
+			return
+		}
+	}
+}
+
+// samePos returns two terms that are at the same position. Only a term that
+// is repeated in a phrase can be.
+func samePos(ps []*posting, iters []int) (int, int, bool) {
+	for i := range ps {
+		for j := i + 1; j < len(ps); j++ {
+			if ps[i].Pos[iters[i]] == ps[j].Pos[iters[j]] {
+				return i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func containsPos(pos []uint, p int) bool {
+	if p < 0 {
+		return false
+	}
+	i := sort.Search(len(pos), func(i int) bool { return pos[i] >= uint(p) })
+	return i < len(pos) && pos[i] == uint(p)
+}
+
+// tokenTexts returns the text of each token, nil if reading them failed.
+func tokenTexts(tokens []Token, err error) []string {
+	if err != nil {
+		return nil
+	}
+	texts := make([]string, len(tokens))
+	for i, t := range tokens {
+		texts[i] = t.Text
+	}
+	return texts
+}
+
+func readAllTokens(tokens Tokenizer) ([]Token, error) {
+	var res []Token
+	for {
+		tok, err := tokens.Next()
+		if err == io.EOF {
+			return res, nil
+		} else if err != nil {
+			return nil, err
+		}
+		res = append(res, tok)
+	}
+}
+
+// Near matches documents where the terms are all found in the DefaultField
+// within k positions of each other in any order. Documents are scored higher
+// the closer together the terms are.
+func Near(k int, terms ...string) Query {
+	q := &nearQuery{field: DefaultField, k: k, terms: make([]string, 0, len(terms))}
+	for _, t := range terms {
+		if w := cleanWord(t); len(w) > 0 {
+			q.terms = append(q.terms, string(w))
+		}
+	}
+	return q
+}
+
+type nearQuery struct {
+	field string
+	k     int
+	terms []string
+}
+
+func (nq *nearQuery) Keys() []string { return nq.terms }
+
+func (nq *nearQuery) String() string {
+	terms := make([]string, len(nq.terms))
+	for i, t := range nq.terms {
+		terms[i] = escapeTerm(t)
+	}
+	return fieldPrefix(nq.field) + "NEAR/" + strconv.Itoa(nq.k) + "(" + strings.Join(terms, " ") + ")"
+}
+
+func (nq *nearQuery) search(ix *Index) []*posting {
+	if len(nq.terms) == 0 {
+		return nil
+	}
+	var (
+		lists   = make([][]*posting, len(nq.terms))
+		offsets = make([]int, len(nq.terms))
+		result  []*posting
+	)
+	for i, t := range nq.terms {
+		if lists[i] = ix.postings(fieldKey(nq.field, t)); len(lists[i]) == 0 {
+			return nil
+		}
+	}
+	// The smallest spread that n terms at different positions can have
+	closest := len(nq.terms) - 1
+	intersectEach(lists, func(ps []*posting) {
+		var (
+			pos  []uint
+			best = -1
+		)
+		windows(ps, offsets, nq.k, func(start uint, spread int) {
+			if len(pos) == 0 || pos[len(pos)-1] != start {
+				pos = append(pos, start)
+			}
+			if best < 0 || spread < best {
+				best = spread
+			}
+		})
+		if len(pos) > 0 {
+			result = append(result, &posting{
+				ID:   ps[0].ID,
+				Pos:  pos,
+				hits: []hit{{weight: 1 / float64(1+best-closest)}},
+			})
+		}
+	})
+	return asTerm(nq.String(), result)
+}
+
+var (
+	_ Query = (*phraseQuery)(nil)
+	_ Query = (*nearQuery)(nil)
+)
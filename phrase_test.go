@@ -0,0 +1,117 @@
+package ts
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestTokenPositions(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	positions := func(a Analyzer, text string) map[string]uint {
+		tokens, err := a.Analyze(strings.NewReader(text))
+		is.NoErr(err)
+		toks, err := readAllTokens(tokens)
+		is.NoErr(err)
+		res := make(map[string]uint)
+		for i, tok := range toks {
+			if i > 0 {
+				is.True(tok.Pos > toks[i-1].Pos) // positions are in order
+			}
+			res[tok.Text] = tok.Pos
+		}
+		return res
+	}
+	is.Equal(positions(SimpleAnalyzer, "the art of war\nby sun tzu"), map[string]uint{
+		"art": 1, "war": 3, "sun": 5, "tzu": 6,
+	})
+	is.Equal(positions(ProseAnalyzer, "Hello, distributed (systems)."), map[string]uint{
+		"Hello": 0, "distributed": 1, "systems": 2,
+	})
+}
+
+func TestPhraseQuery(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	for _, doc := range []*Document{
+		NewDocument("dist", TextField(DefaultField, "notes on distributed systems and their failures")),
+		NewDocument("apart", TextField(DefaultField, "distributed consensus for replicated systems")),
+		NewDocument("swapped", TextField(DefaultField, "systems distributed across datacenters")),
+		NewDocument("stop", TextField(DefaultField, "the art of war")),
+		NewDocument("repeat", TextField(DefaultField, "alpha beta gamma gamma")),
+		NewDocument("values",
+			TextField("title", "scaling distributed"),
+			TextField("title", "systems programming")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(q Query) []string {
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		sort.Strings(res)
+		return res
+	}
+	is.Equal(names(And(StringQuery("distributed"), StringQuery("systems"))), []string{"apart", "dist", "swapped"})
+	is.Equal(names(PhraseQuery(DefaultField, "distributed systems")), []string{"dist"})
+	is.Equal(names(PhraseQuery(DefaultField, "Distributed, Systems.")), []string{"dist"})
+	is.Equal(names(PhraseQuery(DefaultField, "systems distributed")), []string{"swapped"})
+	is.Equal(names(SloppyPhraseQuery(DefaultField, "distributed systems", 3)), []string{"apart", "dist", "swapped"})
+	is.Equal(names(SloppyPhraseQuery(DefaultField, "distributed systems", 2)), []string{"dist", "swapped"})
+	is.Equal(names(SloppyPhraseQuery(DefaultField, "distributed systems", 1)), []string{"dist"})
+	is.Equal(names(PhraseQuery(DefaultField, "art of war")), []string{"stop"})
+	is.Equal(names(PhraseQuery(DefaultField, "art war")), []string{})
+	is.Equal(names(PhraseQuery(DefaultField, "art to war")), []string{"stop"})
+	is.Equal(names(PhraseQuery(DefaultField, "war war")), []string{})
+	is.Equal(names(SloppyPhraseQuery(DefaultField, "war war", 3)), []string{})
+	// Each copy of a repeated term matches a different word.
+	is.Equal(names(SloppyPhraseQuery(DefaultField, "alpha gamma gamma", 1)), []string{"repeat"})
+	is.Equal(names(SloppyPhraseQuery(DefaultField, "alpha gamma gamma", 3)), []string{"repeat"})
+	is.Equal(names(SloppyPhraseQuery(DefaultField, "gamma gamma gamma", 3)), []string{})
+	is.Equal(names(PhraseQuery(DefaultField, "distributed unknown")), []string{})
+	// Phrases do not match across values of a field.
+	is.Equal(names(PhraseQuery("title", "distributed systems")), []string{})
+	is.Equal(names(PhraseQuery("title", "systems programming")), []string{"values"})
+}
+
+func TestNear(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex()
+	for _, doc := range []*Document{
+		NewDocument("far", TextField(DefaultField, "leader chosen by random timeouts then later an election")),
+		NewDocument("close", TextField(DefaultField, "raft uses leader election")),
+		NewDocument("reversed", TextField(DefaultField, "an election picks a new leader")),
+		NewDocument("gap", TextField(DefaultField, "leader based election")),
+		NewDocument("repeat", TextField(DefaultField, "alpha beta gamma gamma")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(res []*QueryResult) []string {
+		names := make([]string, 0, len(res))
+		for _, r := range res {
+			names = append(names, r.DocumentName)
+		}
+		return names
+	}
+	res := ix.Search(Near(4, "leader", "Election"))
+	is.Equal(names(res), []string{"close", "gap", "reversed"})
+	is.True(res[0].Rank > res[1].Rank)
+	is.True(res[1].Rank > res[2].Rank)
+	is.Equal(names(ix.Search(Near(1, "election", "leader"))), []string{"close"})
+	is.Equal(len(ix.Search(Near(9, "leader", "election"))), 4)
+	is.Equal(len(ix.Search(Near(3, "leader", "missing"))), 0)
+	is.Equal(len(ix.Search(Near(3, "leader", "leader"))), 0)
+	// A repeated term has to be found once for each time it is repeated.
+	is.Equal(names(ix.Search(Near(3, "alpha", "gamma", "gamma"))), []string{"repeat"})
+	is.Equal(names(ix.Search(Near(3, "gamma", "alpha", "gamma"))), []string{"repeat"})
+	is.Equal(len(ix.Search(Near(2, "alpha", "gamma", "gamma"))), 0)
+	is.Equal(len(ix.Search(Near(3, "gamma", "gamma", "gamma"))), 0)
+}
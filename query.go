@@ -1,10 +1,27 @@
 package ts
 
+import (
+	"sort"
+	"strings"
+)
+
 type QueryResult struct {
 	Rank         float64
 	TokenCount   int
 	DocumentName string
-	DocumentID   uint64
+	DocumentID   DocID
+	// Fields holds the stored fields of the document that were requested
+	// with LoadFields. If a field was stored more than once only the first
+	// value is kept, use Index.Document to get every value.
+	Fields map[string]string
+	// Snippets of the document with the query terms highlighted when the
+	// search was run with Highlight.
+	Snippets []string
+	// Explanation of how Rank was computed when the search was run with
+	// Explain.
+	Explanation *Explanation
+	// Values of the document for the sort fields of the search
+	sortKeys []sortKey
 }
 
 type QueryResults []*QueryResult
@@ -13,9 +30,66 @@ func (r QueryResults) Len() int           { return len(r) }
 func (r QueryResults) Less(i, j int) bool { return r[i].Rank >= r[j].Rank }
 func (r QueryResults) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
 
+// SearchOption configures a single search.
+type SearchOption func(*searchOptions)
+
+type searchOptions struct {
+	// Stored fields to load, nil when no fields should be loaded
+	fields map[string]struct{}
+	// Highlighter used for snippets, nil when no snippets should be made
+	highlight *Highlighter
+	// Set when results should explain their rank
+	explain bool
+	// Scorer that overrides the index's Scorer, nil to use the index's
+	scorer Scorer
+	// Highest document ID that the search can see, nil if every document
+	// is searched
+	snapshot *DocID
+	// Filters the results of top k searches, nil to keep every result
+	accept func(*QueryResult) bool
+	// Fields that results are sorted by, nil to sort by rank
+	sort []SortField
+}
+
+// LoadFields will load stored fields into the Fields of each search result.
+// Every stored field is loaded if no fields are given.
+func LoadFields(fields ...string) SearchOption {
+	return func(so *searchOptions) {
+		so.fields = make(map[string]struct{}, len(fields))
+		for _, f := range fields {
+			so.fields[f] = struct{}{}
+		}
+	}
+}
+
+// Explain will add an Explanation of its rank to each search result.
+func Explain() SearchOption {
+	return func(so *searchOptions) { so.explain = true }
+}
+
+// ScoreWith ranks the results of a search with s instead of the index's
+// Scorer.
+func ScoreWith(s Scorer) SearchOption {
+	return func(so *searchOptions) { so.scorer = s }
+}
+
+func newSearchOptions(opts []SearchOption) *searchOptions {
+	so := &searchOptions{}
+	for _, o := range opts {
+		o(so)
+	}
+	return so
+}
+
+// Query is a search query that can be run against an Index.
 type Query interface {
-	Join([][]*posting) []*posting
+	// Keys returns the terms that the query searches for.
 	Keys() []string
+	// String returns the query in the syntax read by ParseQuery.
+	String() string
+	// search returns the postings of every document matching the query
+	// ordered by document ID. It is called with the index's read lock held.
+	search(*Index) []*posting
 }
 
 func And(queries ...Query) Query {
@@ -23,21 +97,15 @@ func And(queries ...Query) Query {
 }
 
 func Or(query ...string) Query {
-	tokens := make([]string, len(query))
-	for i, t := range query {
-		tokens[i] = string(cleanWord(t))
-	}
-	return &unionQuery{queries: tokens}
+	return &unionQuery{queries: query}
 }
 
+// StringQuery matches documents containing a term in the DefaultField. The
+// text is analyzed with the field's analyzer when the query is searched.
 type StringQuery string
 
-func (sq StringQuery) Join(p [][]*posting) []*posting {
-	postings := make([]*posting, 0, len(p))
-	for _, posts := range p {
-		postings = append(postings, posts...)
-	}
-	return postings
+func (sq StringQuery) search(ix *Index) []*posting {
+	return ix.termSearch(DefaultField, string(sq))
 }
 
 func (sq StringQuery) Keys() []string {
@@ -45,14 +113,149 @@ func (sq StringQuery) Keys() []string {
 	return []string{string(k)}
 }
 
+func (sq StringQuery) String() string { return escapeTerm(string(sq)) }
+
+// FieldQuery matches documents containing a term in a specific field. The
+// text is analyzed with the field's analyzer when the query is searched, or
+// matched exactly if the field holds keywords.
+func FieldQuery(field, text string) Query {
+	return &fieldQuery{field: field, text: text}
+}
+
+// KeywordQuery matches documents with a keyword field that is exactly value.
+func KeywordQuery(field, value string) Query {
+	return &fieldQuery{field: field, text: value, keyword: true}
+}
+
+type fieldQuery struct {
+	field, text string
+	// Set when text is matched exactly rather than analyzed
+	keyword bool
+}
+
+func (fq *fieldQuery) Keys() []string {
+	if fq.keyword {
+		return []string{fq.text}
+	}
+	return []string{string(cleanWord(fq.text))}
+}
+
+func (fq *fieldQuery) String() string { return fieldPrefix(fq.field) + escapeTerm(fq.text) }
+
+func (fq *fieldQuery) search(ix *Index) []*posting {
+	if fq.keyword {
+		return ix.termPostings(fieldKey(fq.field, fq.text))
+	}
+	return ix.termSearch(fq.field, fq.text)
+}
+
+// analyzeTerm returns the terms that the text of a term query is searched
+// for in a field. Text is matched exactly in keyword fields and analyzed
+// with the field's analyzer in other fields.
+func (ix *Index) analyzeTerm(field, text string) []string {
+	if _, ok := ix.keywords[field]; ok {
+		return []string{text}
+	}
+	tokens, err := ix.analyzerFor(Field{Name: field}).Analyze(strings.NewReader(text))
+	if err != nil {
+		return nil
+	}
+	return tokenTexts(readAllTokens(tokens))
+}
+
+// termSearch returns the postings of the documents containing every term
+// that text is analyzed to in a field.
+func (ix *Index) termSearch(field, text string) []*posting {
+	terms := ix.analyzeTerm(field, text)
+	if len(terms) == 1 {
+		return ix.termPostings(fieldKey(field, terms[0]))
+	}
+	lists := make([][]*posting, len(terms))
+	for i, t := range terms {
+		if lists[i] = ix.termPostings(fieldKey(field, t)); len(lists[i]) == 0 {
+			return nil
+		}
+	}
+	return kIntersect(lists)
+}
+
+// AnyFieldQuery matches documents containing a term in any field except the
+// excluded fields.
+func AnyFieldQuery(text string, exclude ...string) Query {
+	q := &anyFieldQuery{
+		text:    text,
+		exclude: make(map[string]struct{}, len(exclude)),
+	}
+	for _, f := range exclude {
+		q.exclude[f] = struct{}{}
+	}
+	return q
+}
+
+type anyFieldQuery struct {
+	text    string
+	exclude map[string]struct{}
+}
+
+func (aq *anyFieldQuery) Keys() []string { return []string{string(cleanWord(aq.text))} }
+
+// String returns the query searching every field. Excluded fields cannot be
+// written in the query syntax so they are left out.
+func (aq *anyFieldQuery) String() string { return "*:" + escapeTerm(aq.text) }
+
+func (aq *anyFieldQuery) search(ix *Index) []*posting {
+	lists := make([][]*posting, 0, len(ix.fields))
+	for field := range ix.fields {
+		if _, ok := aq.exclude[field]; ok {
+			continue
+		}
+		if p := ix.termSearch(field, aq.text); len(p) > 0 {
+			lists = append(lists, p)
+		}
+	}
+	return union(lists)
+}
+
 type intersectQuery struct{ queries []Query }
 
-func (iq *intersectQuery) Join(posts [][]*posting) []*posting {
-	postings := make([][]*posting, 0, len(posts))
+func (iq *intersectQuery) search(ix *Index) []*posting {
+	var (
+		postings = make([][]*posting, 0, len(iq.queries))
+		excluded [][]*posting
+	)
 	for _, q := range iq.queries {
-		postings = append(postings, q.Join(posts))
+		// Negated queries are subtracted from the intersection rather than
+		// intersecting with every other document.
+		if qs, ok := exclusions(q); ok {
+			excluded = appendResults(excluded, ix, qs)
+			continue
+		}
+		p := q.search(ix)
+		if len(p) == 0 {
+			return nil
+		}
+		postings = append(postings, p)
+	}
+	if len(postings) == 0 {
+		return ix.complement(union(excluded))
+	}
+	res := kIntersect(postings)
+	if len(excluded) > 0 {
+		res = difference(res, union(excluded))
+	}
+	return res
+}
+
+func (iq *intersectQuery) String() string {
+	parts := make([]string, len(iq.queries))
+	for i, q := range iq.queries {
+		if qs, ok := exclusions(q); ok && len(qs) == 1 {
+			parts[i] = "-" + qs[0].String()
+			continue
+		}
+		parts[i] = "+" + q.String()
 	}
-	return kIntersect(postings)
+	return "(" + strings.Join(parts, " ") + ")"
 }
 
 func (iq *intersectQuery) Keys() []string {
@@ -65,14 +268,30 @@ func (iq *intersectQuery) Keys() []string {
 
 type unionQuery struct{ queries []string }
 
-func (uq *unionQuery) Keys() []string { return uq.queries }
+func (uq *unionQuery) Keys() []string {
+	keys := make([]string, len(uq.queries))
+	for i, q := range uq.queries {
+		keys[i] = string(cleanWord(q))
+	}
+	return keys
+}
+
+func (uq *unionQuery) String() string {
+	parts := make([]string, len(uq.queries))
+	for i, q := range uq.queries {
+		parts[i] = escapeTerm(q)
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
 
-func (uq *unionQuery) Join(postings [][]*posting) []*posting {
-	p := make([]*posting, len(postings)*2)
-	for _, posting := range postings {
-		p = append(p, posting...)
+func (uq *unionQuery) search(ix *Index) []*posting {
+	lists := make([][]*posting, 0, len(uq.queries))
+	for _, q := range uq.queries {
+		if p := ix.termSearch(DefaultField, q); len(p) > 0 {
+			lists = append(lists, p)
+		}
 	}
-	return p
+	return union(lists)
 }
 
 // QueryTree results in the combination of two queries
@@ -89,78 +308,152 @@ func (qt *queryTree) Keys() []string {
 	return append(keys, right...)
 }
 
-func (qt *queryTree) Join(postings [][]*posting) []*posting {
-	p := make([]*posting, 0)
-	p = append(p, qt.left.Join(postings)...)
-	p = append(p, qt.right.Join(postings)...)
-	return p
+func (qt *queryTree) String() string {
+	return "(" + qt.left.String() + " " + qt.right.String() + ")"
+}
+
+func (qt *queryTree) search(ix *Index) []*posting {
+	return union([][]*posting{qt.left.search(ix), qt.right.search(ix)})
 }
 
 var (
 	// interface checks
 	_ Query = (*StringQuery)(nil)
+	_ Query = (*fieldQuery)(nil)
+	_ Query = (*anyFieldQuery)(nil)
 	_ Query = (*intersectQuery)(nil)
 	_ Query = (*unionQuery)(nil)
 	_ Query = (*queryTree)(nil)
 )
 
-func kIntersect(list [][]*posting) []*posting {
+// union merges postings lists that are sorted by document ID. The positions
+// of postings with the same document ID are combined.
+func union(lists [][]*posting) []*posting {
+	switch len(lists) {
+	case 0:
+		return nil
+	case 1:
+		return lists[0]
+	}
+	res := lists[0]
+	for _, list := range lists[1:] {
+		res = union2(res, list)
+	}
+	return res
+}
+
+func union2(left, right []*posting) []*posting {
 	var (
-		i            uint64
-		ix, smallest uint64
-		p            *posting
-		n            = uint64(len(list))
-		result       = make([]*posting, 0)
-		iters        = make([]uint64, len(list))
+		l, r int
+		res  = make([]*posting, 0, len(left)+len(right))
 	)
-
-	for {
-		ix = 1
-		smallest = maxUint
-		for i = 1; i < n; i++ {
-			// Check bounds on all the iterator's current indices.
-			if iters[i] >= uint64(len(list[i])) {
-				return result
-			}
-			// If even one of the current values is not
-			// the same as the rest, then we need to
-			// find the list with the smallest current value
-			// and advance it by one.
-			if list[0][iters[0]].ID != list[i][iters[i]].ID {
-				if list[i][iters[i]].ID < smallest {
-					smallest = uint64(list[i][iters[i]].ID)
-					ix = i
-				}
-				goto NotEq
-			}
+	for l < len(left) && r < len(right) {
+		if left[l].ID < right[r].ID {
+			res = append(res, left[l])
+			l++
+		} else if right[r].ID < left[l].ID {
+			res = append(res, right[r])
+			r++
+		} else {
+			pos := make([]uint, 0, len(left[l].Pos)+len(right[r].Pos))
+			pos = append(pos, left[l].Pos...)
+			res = append(res, &posting{
+				ID:   left[l].ID,
+				Pos:  append(pos, right[r].Pos...),
+				hits: combineHits(left[l], right[r]),
+			})
+			l++
+			r++
 		}
-		// All current IDs are equal, store the
-		// positions in a new posting and advance
-		// all iterators.
-		p = &posting{
-			ID:  list[0][iters[0]].ID,
-			Pos: make([]uint, 0, n),
+	}
+	res = append(res, left[l:]...)
+	return append(res, right[r:]...)
+}
+
+// kIntersect intersects postings lists that are sorted by document ID. The
+// positions of the matching postings are combined.
+func kIntersect(list [][]*posting) []*posting {
+	result := make([]*posting, 0)
+	intersectEach(list, func(ps []*posting) {
+		// Store the positions from every list in a new posting.
+		p := &posting{
+			ID:   ps[0].ID,
+			Pos:  make([]uint, 0, len(ps)),
+			hits: combineHits(ps...),
 		}
-		for k := uint(0); k < uint(n); k++ {
-			p.Pos = append(p.Pos, list[k][iters[k]].Pos...)
-			iters[k]++ // advance all
+		for _, q := range ps {
+			p.Pos = append(p.Pos, q.Pos...)
 		}
 		result = append(result, p)
-		continue
+	})
+	return result
+}
 
-	NotEq: // they are not equal, advance the smallest one
-		for k := ix; k < n; k++ {
-			if iters[k] >= uint64(len(list[k])) {
-				continue
+// intersectEach calls fn with the postings of each document that is found in
+// every list. The postings passed to fn are in the same order as the lists.
+func intersectEach(list [][]*posting, fn func([]*posting)) {
+	var (
+		n     = len(list)
+		iters = make([]int, n)
+		ps    = make([]*posting, n)
+	)
+	if n == 0 {
+		return
+	}
+	for {
+		// Find the largest current document ID.
+		var max DocID
+		for i := 0; i < n; i++ {
+			if iters[i] >= len(list[i]) {
+				return
+			}
+			if id := list[i][iters[i]].ID; id > max {
+				max = id
+			}
+		}
+		// Skip every list ahead to the largest ID.
+		equal := true
+		for i := 0; i < n; i++ {
+			iters[i] = seek(list[i], iters[i], max)
+			if iters[i] >= len(list[i]) {
+				return
 			}
-			v := uint64(list[k][iters[k]].ID)
-			if v < smallest {
-				smallest = v
-				ix = k
+			if list[i][iters[i]].ID != max {
+				equal = false
 			}
 		}
-		iters[ix]++ // advance the smallest one
+		if !equal {
+			continue
+		}
+		// All current IDs are equal so advance all iterators.
+		for i := 0; i < n; i++ {
+			ps[i] = list[i][iters[i]]
+			iters[i]++
+		}
+		fn(ps)
+	}
+}
+
+// seek returns the index of the first posting at or after start with an ID
+// greater than or equal to id. It gallops forward in doubling steps before
+// searching so skipping a short distance is cheap.
+func seek(list []*posting, start int, id DocID) int {
+	if start >= len(list) || list[start].ID >= id {
+		return start
+	}
+	lo, step := start, 1
+	for lo+step < len(list) && list[lo+step].ID < id {
+		lo += step
+		step *= 2
+	}
+	hi := lo + step
+	if hi > len(list) {
+		hi = len(list)
 	}
+	rest := list[lo+1 : hi]
+	return lo + 1 + sort.Search(len(rest), func(i int) bool {
+		return rest[i].ID >= id
+	})
 }
 
 func intersect(left, right []*posting) []*posting {
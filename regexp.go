@@ -0,0 +1,261 @@
+package ts
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// RegexpQuery matches documents containing a term in the DefaultField that
+// is matched in full by a regular expression using the syntax of the regexp
+// package. At most maxExpansions terms are searched, or DefaultMaxExpansions
+// if maxExpansions is not positive, preferring terms that are found in more
+// documents.
+//
+// The expression is run against the sorted term dictionary so terms that
+// share a prefix are only matched once and every term after a prefix that
+// can no longer match is skipped.
+func RegexpQuery(expr string, maxExpansions int) (Query, error) {
+	re, err := regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	if maxExpansions <= 0 {
+		maxExpansions = DefaultMaxExpansions
+	}
+	prefix, _ := re.LiteralPrefix()
+	q := &regexpQuery{
+		field:         DefaultField,
+		expr:          expr,
+		prefix:        prefix,
+		re:            re,
+		maxExpansions: maxExpansions,
+	}
+	if !hasWordBoundary(prog) {
+		q.automaton = &termAutomaton{prog: prog}
+	}
+	return q, nil
+}
+
+type regexpQuery struct {
+	field, expr string
+	// Literal prefix of every matching term
+	prefix string
+	re     *regexp.Regexp
+	// nil if the expression cannot be matched one rune at a time
+	automaton     *termAutomaton
+	maxExpansions int
+}
+
+func (rq *regexpQuery) Keys() []string { return nil }
+
+func (rq *regexpQuery) String() string {
+	return fieldPrefix(rq.field) + "/" + strings.ReplaceAll(rq.expr, "/", `\/`) + "/"
+}
+
+func (rq *regexpQuery) search(ix *Index) []*posting {
+	var terms []expansion
+	if rq.automaton == nil {
+		terms = ix.matchTerms(rq.field, rq.prefix, func(token string) (int, bool) {
+			return 0, rq.re.MatchString(token)
+		})
+	} else {
+		start := fieldKey(rq.field, rq.prefix)
+		base := len(rq.field) + len(fieldSep)
+		terms = ix.collectTerms(func(seg *segment, emit func(string, int, *term)) {
+			rq.automaton.intersect(seg.sortedKeys(), start, base, func(key string) {
+				emit(key, 0, seg.terms[key])
+			})
+		})
+	}
+	return expand(ix, rq.field, terms, rq.maxExpansions)
+}
+
+// termAutomaton runs a compiled regular expression over terms one rune at a
+// time. A state is the set of instructions that are waiting for the next
+// rune, so a term can be matched from the state that its prefix left behind.
+type termAutomaton struct {
+	prog *syntax.Prog
+}
+
+// hasWordBoundary reports whether a program has assertions that need to
+// look at the rune after the current one.
+func hasWordBoundary(prog *syntax.Prog) bool {
+	for _, inst := range prog.Inst {
+		if inst.Op == syntax.InstEmptyWidth &&
+			syntax.EmptyOp(inst.Arg)&(syntax.EmptyWordBoundary|syntax.EmptyNoWordBoundary) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// closure adds the instructions reachable from pc without reading a rune.
+// Assertions about the end of the text are kept in the state since it is not
+// known yet if the term ends here.
+func (a *termAutomaton) closure(state []uint32, seen []bool, pc uint32, begin bool) []uint32 {
+	if seen[pc] {
+		return state
+	}
+	seen[pc] = true
+	inst := &a.prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstAlt, syntax.InstAltMatch:
+		state = a.closure(state, seen, inst.Out, begin)
+		return a.closure(state, seen, inst.Arg, begin)
+	case syntax.InstCapture, syntax.InstNop:
+		return a.closure(state, seen, inst.Out, begin)
+	case syntax.InstEmptyWidth:
+		op := syntax.EmptyOp(inst.Arg)
+		if op&(syntax.EmptyBeginText|syntax.EmptyBeginLine) != 0 {
+			if !begin {
+				return state
+			}
+			op &^= syntax.EmptyBeginText | syntax.EmptyBeginLine
+		}
+		if op == 0 {
+			return a.closure(state, seen, inst.Out, begin)
+		}
+		return append(state, pc)
+	case syntax.InstFail:
+		return state
+	}
+	return append(state, pc)
+}
+
+func (a *termAutomaton) start() []uint32 {
+	return a.closure(nil, make([]bool, len(a.prog.Inst)), uint32(a.prog.Start), true)
+}
+
+// step returns the state after reading a rune.
+func (a *termAutomaton) step(state []uint32, r rune) []uint32 {
+	var (
+		next []uint32
+		seen = make([]bool, len(a.prog.Inst))
+	)
+	for _, pc := range state {
+		inst := &a.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstRune, syntax.InstRune1, syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+			if inst.MatchRune(r) {
+				next = a.closure(next, seen, inst.Out, false)
+			}
+		}
+	}
+	return next
+}
+
+// accepts reports whether a term that ends in a state is matched.
+func (a *termAutomaton) accepts(state []uint32) bool {
+	for _, pc := range state {
+		inst := &a.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstMatch:
+			return true
+		case syntax.InstEmptyWidth:
+			// Only assertions about the end of the text are left in a state
+			// and they are all true at the end of a term.
+			seen := make([]bool, len(a.prog.Inst))
+			seen[pc] = true
+			if a.accepts(a.closureAtEnd(nil, seen, inst.Out)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closureAtEnd is closure at the end of a term where assertions about the
+// end of the text are true and other assertions are false.
+func (a *termAutomaton) closureAtEnd(state []uint32, seen []bool, pc uint32) []uint32 {
+	if seen[pc] {
+		return state
+	}
+	seen[pc] = true
+	inst := &a.prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstAlt, syntax.InstAltMatch:
+		state = a.closureAtEnd(state, seen, inst.Out)
+		return a.closureAtEnd(state, seen, inst.Arg)
+	case syntax.InstCapture, syntax.InstNop:
+		return a.closureAtEnd(state, seen, inst.Out)
+	case syntax.InstEmptyWidth:
+		if syntax.EmptyOp(inst.Arg)&^(syntax.EmptyEndText|syntax.EmptyEndLine) == 0 {
+			return a.closureAtEnd(state, seen, inst.Out)
+		}
+		return state
+	case syntax.InstMatch:
+		return append(state, pc)
+	}
+	return state
+}
+
+// intersect calls fn with every key in sorted keys that starts with start
+// and has a token, found after the first base bytes of the key, that the
+// automaton matches. The states of a key's prefixes are kept on a stack so
+// that keys sharing a prefix only run the automaton over the rest of the
+// key, and when a prefix leaves no states every key with that prefix is
+// skipped.
+func (a *termAutomaton) intersect(keys []string, start string, base int, fn func(key string)) {
+	type frame struct {
+		depth int
+		state []uint32
+	}
+	var (
+		stack = []frame{{0, a.start()}}
+		prev  string
+		i     = sort.SearchStrings(keys, start)
+	)
+	for i < len(keys) && strings.HasPrefix(keys[i], start) {
+		token := keys[i][base:]
+		common := commonPrefix(prev, token)
+		for stack[len(stack)-1].depth > common {
+			stack = stack[:len(stack)-1]
+		}
+		top := stack[len(stack)-1]
+		for top.depth < len(token) && len(top.state) > 0 {
+			r, size := utf8.DecodeRuneInString(token[top.depth:])
+			top = frame{top.depth + size, a.step(top.state, r)}
+			stack = append(stack, top)
+		}
+		prev = token
+		if len(top.state) == 0 {
+			// Skip every key with the prefix that failed to match.
+			dead := keys[i][:base+top.depth]
+			rest := keys[i:]
+			i += sort.Search(len(rest), func(j int) bool {
+				return !strings.HasPrefix(rest[j], dead)
+			})
+			continue
+		}
+		if a.accepts(top.state) {
+			fn(keys[i])
+		}
+		i++
+	}
+}
+
+func commonPrefix(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+var _ Query = (*regexpQuery)(nil)
@@ -0,0 +1,95 @@
+package ts
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestRegexpQuery(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	for _, doc := range []*Document{
+		NewDocument("read", TextField(DefaultField, "rpc_read_timeout exceeded")),
+		NewDocument("write", TextField(DefaultField, "rpc_write_timeout exceeded")),
+		NewDocument("retry", TextField(DefaultField, "rpc_retry_count reached")),
+		NewDocument("other", TextField(DefaultField, "http_read_timeout exceeded")),
+		NewDocument("digits", TextField(DefaultField, "rpc_2_timeout")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(expr string, limit int) []string {
+		q, err := RegexpQuery(expr, limit)
+		is.NoErr(err)
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		sort.Strings(res)
+		return res
+	}
+	is.Equal(names(`rpc_[a-z]+_timeout`, 0), []string{"read", "write"})
+	is.Equal(names(`rpc_\w+_timeout`, 0), []string{"digits", "read", "write"})
+	is.Equal(names(`[a-z]+_read_timeout`, 0), []string{"other", "read"})
+	is.Equal(names(`rpc_`, 0), []string{}) // terms must match in full
+	is.Equal(names(`^rpc_.*_count$`, 0), []string{"retry"})
+	is.Equal(names(`(?i)RPC_RE.*`, 0), []string{"read", "retry"})
+	is.Equal(names(`\brpc_\d_timeout\b`, 0), []string{"digits"})
+	is.Equal(len(names(`rpc_.*`, 2)), 2)
+
+	_, err := RegexpQuery(`rpc_(`, 0)
+	is.True(err != nil)
+}
+
+func TestTermAutomaton(t *testing.T) {
+	t.Parallel()
+	var (
+		r     = rand.New(rand.NewSource(1))
+		keys  = make([]string, 0)
+		field = "f" + fieldSep
+	)
+	for i := 0; i < 2000; i++ {
+		b := make([]byte, 1+r.Intn(6))
+		for j := range b {
+			b[j] = "abc_1"[r.Intn(5)]
+		}
+		keys = append(keys, field+string(b))
+	}
+	keys = append(keys, field+"é", field+"aé", "g"+fieldSep+"abc")
+	sort.Strings(keys)
+	for _, expr := range []string{
+		`a`, `a+`, `ab*c`, `a.c`, `[a-c]_?1`, `(ab|ba)+`, `.*1`, `.`, `é`, `a.`,
+		`(?i)AB`, `^a$`, `a$`, `b{2,3}`, `(a|)c`, `x`, `.*`,
+	} {
+		q, err := RegexpQuery(expr, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rq := q.(*regexpQuery)
+		re := regexp.MustCompile(`^(?:` + expr + `)$`)
+		var got, want []string
+		rq.automaton.intersect(keys, field+rq.prefix, len(field), func(key string) {
+			got = append(got, key)
+		})
+		for _, key := range keys {
+			if len(key) > len(field) && key[:len(field)] == field && re.MatchString(key[len(field):]) {
+				want = append(want, key)
+			}
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d matches, want %d", expr, len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %q, want %q", expr, got[i], want[i])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package ts
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// TermStats holds the statistics used to score a single term against a single
+// document. A term is a term of the query or a match that is scored as one
+// term such as a phrase.
+type TermStats struct {
+	// Freq is the number of times the term occurs in the document.
+	Freq int
+	// MaxFreq is the frequency of the most frequent term in the document.
+	MaxFreq float64
+	// DocFreq is the number of documents that contain the term.
+	DocFreq int
+	// DocCount is the number of documents in the index.
+	DocCount int
+	// DocLen is the number of tokens in the document.
+	DocLen float64
+	// AvgDocLen is the average number of tokens in a document of the index.
+	AvgDocLen float64
+	// DocNorm is the Euclidean norm of the document's vector of term
+	// frequencies.
+	DocNorm float64
+	// QueryNorm is the Euclidean norm of the query's vector of term weights,
+	// where each term is weighted by ln(1 + DocCount/DocFreq).
+	QueryNorm float64
+}
+
+// Scorer computes the score of a single term in a document. The rank of a
+// search result is the sum of the scores of the query terms that the document
+// matched.
+type Scorer interface {
+	Score(*TermStats) float64
+}
+
+// BoundedScorer is a Scorer that can bound the score of a term so that
+// SearchTopK can skip documents that cannot rank among the best results.
+type BoundedScorer interface {
+	Scorer
+	// MaxScore returns a score at least as high as the score of the term in
+	// any document. Freq is the highest frequency of the term in a single
+	// document and the statistics of the document are unset.
+	MaxScore(*TermStats) float64
+}
+
+// TFIDF scores documents using the max-tf normalized term frequency times the
+// log2 inverse document frequency.
+type TFIDF struct{}
+
+func (TFIDF) Score(s *TermStats) float64 {
+	tf := float64(s.Freq) / s.MaxFreq
+	idf := math.Log2(float64(s.DocCount) / float64(s.DocFreq))
+	return tf * idf
+}
+
+// MaxScore returns the idf of the term since the normalized term frequency is
+// at most one.
+func (TFIDF) MaxScore(s *TermStats) float64 {
+	return math.Log2(float64(s.DocCount) / float64(s.DocFreq))
+}
+
+// Default parameters of BM25.
+const (
+	DefaultK1 = 1.2
+	DefaultB  = 0.75
+)
+
+// BM25 scores documents with the Okapi BM25 ranking function. Term frequency
+// saturates as it grows and is normalized by the length of the document
+// relative to the average document length.
+type BM25 struct {
+	// K1 controls how quickly term frequency saturates.
+	K1 float64
+	// B controls how much the document length normalizes term frequency,
+	// from 0 for none to 1 for full normalization.
+	B float64
+}
+
+// NewBM25 creates a BM25 Scorer with the default parameters.
+func NewBM25() BM25 {
+	return BM25{K1: DefaultK1, B: DefaultB}
+}
+
+func (bm BM25) Score(s *TermStats) float64 {
+	var (
+		n    = float64(s.DocFreq)
+		idf  = math.Log(1 + (float64(s.DocCount)-n+0.5)/(n+0.5))
+		freq = float64(s.Freq)
+		norm = 1 - bm.B
+	)
+	if s.AvgDocLen > 0 {
+		norm += bm.B * s.DocLen / s.AvgDocLen
+	}
+	return idf * freq * (bm.K1 + 1) / (freq + bm.K1*norm)
+}
+
+// MaxScore returns the score of the term at its highest frequency in a
+// document of length zero, which gives the smallest length norm.
+func (bm BM25) MaxScore(s *TermStats) float64 {
+	stats := *s
+	stats.DocLen = 0
+	return bm.Score(&stats)
+}
+
+// VectorSpace ranks documents by the cosine similarity of the query and the
+// document in the vector space model. The query is a vector of the inverse
+// document frequency of its terms and the document a vector of its term
+// frequencies, so ranks are between 0 and 1 for queries without boosts.
+type VectorSpace struct{}
+
+func (VectorSpace) Score(s *TermStats) float64 {
+	if s.DocNorm == 0 || s.QueryNorm == 0 {
+		return 0
+	}
+	idf := smoothIDF(s.DocCount, s.DocFreq)
+	return float64(s.Freq) * idf / (s.DocNorm * s.QueryNorm)
+}
+
+// MaxScore returns the score of a document holding only the term since the
+// frequency of a term is at most the norm of the document.
+func (vs VectorSpace) MaxScore(s *TermStats) float64 {
+	stats := *s
+	stats.DocNorm = float64(s.Freq)
+	return vs.Score(&stats)
+}
+
+// smoothIDF is an inverse document frequency that is positive for terms found
+// in every document.
+func smoothIDF(docCount, docFreq int) float64 {
+	if docFreq == 0 {
+		return 0
+	}
+	return math.Log(1 + float64(docCount)/float64(docFreq))
+}
+
+var (
+	// interface checks
+	_ BoundedScorer = TFIDF{}
+	_ BoundedScorer = BM25{}
+	_ BoundedScorer = VectorSpace{}
+)
+
+// Explanation describes how a value that went into the rank of a search
+// result was computed.
+type Explanation struct {
+	Value       float64
+	Description string
+	// Details are the values that Value was computed from.
+	Details []*Explanation
+}
+
+func (e *Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e *Explanation) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%g = %s\n", strings.Repeat("  ", depth), e.Value, e.Description)
+	for _, d := range e.Details {
+		d.write(b, depth+1)
+	}
+}
+
+// explainTerm explains the score of a single term of a query that is the
+// score of a scorer times the boost of the term.
+func explainTerm(scorer Scorer, key string, s *TermStats, score, boost float64) *Explanation {
+	field, token := splitFieldKey(key)
+	name := token
+	if field != "" {
+		name = fieldPrefix(field) + escapeTerm(token)
+	}
+	return &Explanation{
+		Value:       score * boost,
+		Description: fmt.Sprintf("weight(%s), product of:", name),
+		Details: []*Explanation{
+			{
+				Value: score,
+				Description: fmt.Sprintf("%T score with freq=%d, maxFreq=%g, docFreq=%d, docCount=%d, docLen=%g, avgDocLen=%g",
+					scorer, s.Freq, s.MaxFreq, s.DocFreq, s.DocCount, s.DocLen, s.AvgDocLen),
+			},
+			{Value: boost, Description: "boost"},
+		},
+	}
+}
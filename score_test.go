@@ -0,0 +1,156 @@
+package ts
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestBM25(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	bm := NewBM25()
+	stats := func(freq int, docLen float64) *TermStats {
+		return &TermStats{Freq: freq, DocFreq: 10, DocCount: 1000, DocLen: docLen, AvgDocLen: 100}
+	}
+	// Term frequency saturates towards idf * (k1 + 1).
+	idf := math.Log(1 + (1000-10+0.5)/(10+0.5))
+	prev := 0.0
+	for freq := 1; freq < 100; freq++ {
+		s := bm.Score(stats(freq, 100))
+		is.True(s > prev)
+		is.True(s < idf*(DefaultK1+1))
+		prev = s
+	}
+	is.True(math.Abs(bm.Score(stats(1, 100))-idf) < 1e-9)
+	// Shorter documents score higher unless length normalization is off.
+	is.True(bm.Score(stats(2, 50)) > bm.Score(stats(2, 200)))
+	flat := BM25{K1: DefaultK1, B: 0}
+	is.Equal(flat.Score(stats(2, 50)), flat.Score(stats(2, 200)))
+	// Rare terms score higher than common ones.
+	rare, common := stats(1, 100), stats(1, 100)
+	common.DocFreq = 900
+	is.True(bm.Score(rare) > bm.Score(common))
+	is.True(bm.Score(common) > 0)
+}
+
+func TestScorerSelection(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	docs := []*Document{
+		NewDocument("short", TextField(DefaultField, "raft consensus")),
+		NewDocument("long", TextField(DefaultField, "raft consensus explained through many long winded examples diagrams proofs and figures")),
+		NewDocument("repeated", TextField(DefaultField, "raft raft raft raft consensus and more words about replicated logs")),
+		NewDocument("other", TextField(DefaultField, "google file system")),
+		NewDocument("deleted", TextField(DefaultField, "a deleted document that was very very long and full of words")),
+	}
+	bm, tfidf := NewIndex(), NewIndex(WithScorer(TFIDF{}))
+	for _, ix := range []*Index{bm, tfidf} {
+		for _, doc := range docs {
+			_, err := ix.Add(doc)
+			is.NoErr(err)
+		}
+		is.NoErr(ix.Delete(ix.names["deleted"]))
+		// Stop words are not counted.
+		is.Equal(ix.totalLength, 2+10+8+3.0)
+	}
+	order := func(res []*QueryResult) []string {
+		names := make([]string, len(res))
+		for i, r := range res {
+			names[i] = r.DocumentName
+		}
+		return names
+	}
+	q := StringQuery("consensus")
+	// BM25 prefers the short document where TFIDF cannot tell them apart.
+	res := bm.Search(q)
+	is.Equal(order(res), []string{"short", "repeated", "long"})
+	is.True(res[0].Rank > res[1].Rank)
+	ranks := make(map[string]float64)
+	for _, r := range tfidf.Search(q) {
+		ranks[r.DocumentName] = r.Rank
+	}
+	is.Equal(ranks["short"], ranks["long"])
+
+	// The scorer can be chosen for a single search.
+	want, got := tfidf.Search(StringQuery("raft")), bm.Search(StringQuery("raft"), ScoreWith(TFIDF{}))
+	is.Equal(len(got), len(want))
+	for i := range want {
+		is.Equal(got[i].DocumentName, want[i].DocumentName)
+		is.Equal(got[i].Rank, want[i].Rank)
+	}
+	is.Equal(order(bm.Search(StringQuery("raft"), ScoreWith(BM25{K1: DefaultK1})))[0], "repeated")
+	res = bm.Search(q, Explain())
+	is.Equal(res[0].Explanation.Value, res[0].Rank)
+}
+
+func TestScoringOrder(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := getTestIndex(t)
+	for _, tc := range []struct {
+		query string
+		top   []string
+	}{
+		{"consensus leader election", []string{"raft.txt", "bitcoin.txt"}},
+		{"bitcoin transactions", []string{"bitcoin.txt", "gfs.txt"}},
+		{"dream deferred heart", []string{"harlem.txt", "i-carry-your-heart-with-me.txt", "song-of-myself-1892-version.txt"}},
+		{"web search engine", []string{"google.txt", "near-duplicates-and-shingling.txt"}},
+		{"shingling duplicates", []string{"near-duplicates-and-shingling.txt", "gfs.txt"}},
+		{"roads wood traveler", []string{"the-road-not-taken.txt", "song-of-myself-1892-version.txt"}},
+	} {
+		q, err := ParseQuery(tc.query)
+		is.NoErr(err)
+		for _, s := range []Scorer{NewBM25(), TFIDF{}, VectorSpace{}} {
+			res := ix.Search(q, ScoreWith(s))
+			is.True(len(res) >= len(tc.top))
+			for i, name := range tc.top {
+				if res[i].DocumentName != name {
+					t.Errorf("%T %q: result %d is %s, want %s", s, tc.query, i, res[i].DocumentName, name)
+				}
+			}
+		}
+	}
+	is.Equal(ix.Search(StringQuery("chunk"))[0].DocumentName, "gfs.txt")
+	is.Equal(ix.Search(mustParse(t, "google file system chunk"), ScoreWith(TFIDF{}))[0].DocumentName, "gfs.txt")
+}
+
+func TestTermScoresAreSummed(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := getTestIndex(t)
+	ranks := func(q Query, s Scorer) map[string]float64 {
+		res := make(map[string]float64)
+		for _, r := range ix.Search(q, ScoreWith(s)) {
+			res[r.DocumentName] = r.Rank
+		}
+		return res
+	}
+	// Each term is scored with its own document frequency so a document
+	// matching both terms ranks as the sum of the single term ranks.
+	for _, s := range []Scorer{NewBM25(), TFIDF{}} {
+		a, b := ranks(StringQuery("leader"), s), ranks(StringQuery("cluster"), s)
+		for name, rank := range ranks(QueryTree(StringQuery("leader"), StringQuery("cluster")), s) {
+			if math.Abs(rank-(a[name]+b[name])) > 1e-9 {
+				t.Errorf("%T %s: rank %g, want %g", s, name, rank, a[name]+b[name])
+			}
+		}
+	}
+	// Cosine similarities are at most one and a document holding only the
+	// query's terms is identical to the query.
+	for _, r := range ix.Search(mustParse(t, "web search engine"), ScoreWith(VectorSpace{})) {
+		is.True(r.Rank > 0 && r.Rank <= 1)
+	}
+	small := NewIndex(WithScorer(VectorSpace{}))
+	for _, body := range []string{"raft consensus", "raft raft consensus logs", "paxos"} {
+		_, err := small.AddDocument(body, strings.NewReader(body))
+		is.NoErr(err)
+	}
+	res := small.Search(And(StringQuery("raft"), StringQuery("consensus")))
+	is.Equal(len(res), 2)
+	is.Equal(res[0].DocumentName, "raft consensus")
+	is.True(math.Abs(res[0].Rank-1) < 1e-9)
+	is.True(res[0].Rank > res[1].Rank)
+}
@@ -0,0 +1,360 @@
+package ts
+
+import (
+	"sort"
+	"sync"
+)
+
+// segment is a self contained inverted index over a range of documents.
+//
+// New documents are added to the index's in-memory segment which is flushed
+// into an immutable segment once it holds enough documents. The postings of a
+// flushed segment are never modified, deleting a document only updates the
+// segment's term statistics and deletion set. The postings of deleted
+// documents are purged when the segment is merged.
+type segment struct {
+	terms map[string]*term
+	// Sorted keys of terms, used to find every term with a prefix. Keys of
+	// terms added to the in-memory segment are appended to unsorted and
+	// merged into keys by the first scan that needs them, so adding a
+	// document does not copy the whole dictionary. keysMu serializes the
+	// merge between readers.
+	keys     []string
+	unsorted []string
+	keysMu   sync.Mutex
+	// Number of documents in the segment including deleted documents
+	docs int
+	// Deleted documents that still have postings in the segment
+	deleted map[DocID]struct{}
+	// Range of document IDs held by the segment
+	minID, maxID DocID
+	// Set while the segment is being merged in the background
+	merging bool
+}
+
+func newSegment() *segment {
+	return &segment{
+		terms:   make(map[string]*term),
+		deleted: make(map[DocID]struct{}),
+	}
+}
+
+func (seg *segment) info() SegmentInfo {
+	return SegmentInfo{
+		Docs:    seg.docs,
+		Deleted: len(seg.deleted),
+		Merging: seg.merging,
+	}
+}
+
+// add will add an analyzed document to the segment. Documents must be added
+// in increasing DocID order.
+func (seg *segment) add(id DocID, doc *parsedDoc) {
+	for key, pos := range doc.terms {
+		seg.addPosting(key, &posting{ID: id, Pos: pos})
+	}
+	if seg.docs == 0 {
+		seg.minID = id
+	}
+	seg.maxID = id
+	seg.docs++
+}
+
+// sortedKeys returns the sorted keys of the segment's terms. It is safe to
+// call from concurrent readers.
+func (seg *segment) sortedKeys() []string {
+	seg.keysMu.Lock()
+	defer seg.keysMu.Unlock()
+	if len(seg.unsorted) > 0 {
+		sort.Strings(seg.unsorted)
+		seg.keys = mergeKeys(seg.keys, seg.unsorted)
+		seg.unsorted = nil
+	}
+	return seg.keys
+}
+
+// mergeKeys merges two sorted lists of keys.
+func mergeKeys(a, b []string) []string {
+	res := make([]string, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0] < b[0] {
+			res, a = append(res, a[0]), a[1:]
+		} else {
+			res, b = append(res, b[0]), b[1:]
+		}
+	}
+	res = append(res, a...)
+	return append(res, b...)
+}
+
+// addPosting will add a document's posting to the postings list of a token.
+// Document IDs are assigned in increasing order so appending the posting
+// keeps the postings list sorted. The keys of new terms are left unsorted
+// until the dictionary is scanned.
+func (seg *segment) addPosting(token string, p *posting) {
+	t, ok := seg.terms[token]
+	if !ok {
+		t = &term{token: token}
+		seg.terms[token] = t
+		seg.unsorted = append(seg.unsorted, token)
+	}
+	t.freq += len(p.Pos)
+	t.docs++
+	t.postings = append(t.postings, p)
+	if len(p.Pos) > t.maxFreq {
+		t.maxFreq = len(p.Pos)
+	}
+}
+
+// remove will mark a document as deleted and remove it from the segment's
+// term statistics.
+func (seg *segment) remove(id DocID) {
+	for _, t := range seg.terms {
+		i, ok := t.findPostingByDocID(id)
+		if !ok {
+			continue
+		}
+		t.freq -= len(t.postings[i].Pos)
+		t.docs--
+	}
+	seg.deleted[id] = struct{}{}
+}
+
+func (seg *segment) contains(id DocID) bool {
+	return seg.docs > 0 && seg.minID <= id && id <= seg.maxID
+}
+
+// buildSegment creates a new segment from the postings of a list of adjacent
+// segments leaving out the postings of deleted documents. Only the postings
+// of the source segments are read so it is safe to call while the sources'
+// statistics are being updated.
+func buildSegment(sources []*segment, deleted map[DocID]struct{}) *segment {
+	seg := newSegment()
+	seg.minID = sources[0].minID
+	seg.maxID = sources[len(sources)-1].maxID
+	for _, src := range sources {
+		seg.docs += src.docs
+	}
+	seg.docs -= len(deleted)
+
+	keys := make(map[string]struct{})
+	for _, src := range sources {
+		for key := range src.terms {
+			keys[key] = struct{}{}
+		}
+	}
+	seg.keys = make([]string, 0, len(keys))
+	for key := range keys {
+		var postings []*posting
+		for _, src := range sources {
+			t, ok := src.terms[key]
+			if !ok {
+				continue
+			}
+			for _, p := range t.postings {
+				if _, ok = deleted[p.ID]; !ok {
+					postings = append(postings, p)
+				}
+			}
+		}
+		if len(postings) == 0 {
+			continue
+		}
+		t := &term{
+			token:    key,
+			docs:     len(postings),
+			postings: postings,
+		}
+		for _, p := range postings {
+			t.freq += len(p.Pos)
+			if len(p.Pos) > t.maxFreq {
+				t.maxFreq = len(p.Pos)
+			}
+		}
+		seg.terms[key] = t
+		seg.keys = append(seg.keys, key)
+	}
+	sort.Strings(seg.keys)
+	return seg
+}
+
+// Flush will flush the documents in the in-memory segment into an immutable
+// segment.
+func (ix *Index) Flush() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.flush()
+}
+
+func (ix *Index) flush() {
+	if ix.mem.docs == 0 {
+		return
+	}
+	seg := buildSegment([]*segment{ix.mem}, ix.mem.deleted)
+	ix.mem = newSegment()
+	if seg.docs > 0 {
+		ix.segments = append(ix.segments, seg)
+	}
+	ix.maybeMerge()
+}
+
+// segmentOf returns the segment holding a document.
+func (ix *Index) segmentOf(id DocID) *segment {
+	i := sort.Search(len(ix.segments), func(i int) bool {
+		return ix.segments[i].maxID >= id
+	})
+	if i < len(ix.segments) && ix.segments[i].contains(id) {
+		return ix.segments[i]
+	}
+	return ix.mem
+}
+
+// postings returns the postings list of a key across all segments.
+func (ix *Index) postings(key string) []*posting {
+	var (
+		res   []*posting
+		found int
+	)
+	for _, seg := range ix.segments {
+		if t, ok := seg.terms[key]; ok {
+			res = append(res, t.postings...)
+			found++
+		}
+	}
+	if t, ok := ix.mem.terms[key]; ok {
+		if found == 0 {
+			return t.postings
+		}
+		res = append(res, t.postings...)
+	}
+	return res
+}
+
+// termPostings returns the postings of a key with a hit for the term so that
+// the documents are scored by the term.
+func (ix *Index) termPostings(key string) []*posting {
+	return termHits(key, ix.postings(key))
+}
+
+// docFreq returns the number of live documents containing a key.
+func (ix *Index) docFreq(key string) int {
+	n := 0
+	for _, seg := range ix.segments {
+		if t, ok := seg.terms[key]; ok {
+			n += t.docs
+		}
+	}
+	if t, ok := ix.mem.terms[key]; ok {
+		n += t.docs
+	}
+	return n
+}
+
+// maxFreq returns the highest frequency of a key in a single document.
+func (ix *Index) maxFreq(key string) int {
+	n := 0
+	if t, ok := ix.mem.terms[key]; ok {
+		n = t.maxFreq
+	}
+	for _, seg := range ix.segments {
+		if t, ok := seg.terms[key]; ok && t.maxFreq > n {
+			n = t.maxFreq
+		}
+	}
+	return n
+}
+
+// maybeMerge asks the merge policy for merges and starts them in the
+// background. Must be called with the write lock held.
+func (ix *Index) maybeMerge() {
+	if ix.mergePolicy == nil || len(ix.segments) < 2 && !ix.hasDeletes() {
+		return
+	}
+	infos := make([]SegmentInfo, len(ix.segments))
+	for i, seg := range ix.segments {
+		infos[i] = seg.info()
+	}
+	for _, m := range ix.mergePolicy.FindMerges(infos) {
+		if m.Start < 0 || m.End > len(ix.segments) || m.Start >= m.End {
+			continue
+		}
+		sources := make([]*segment, m.End-m.Start)
+		copy(sources, ix.segments[m.Start:m.End])
+		if anyMerging(sources) {
+			continue
+		}
+		deleted := make(map[DocID]struct{})
+		for _, seg := range sources {
+			seg.merging = true
+			for id := range seg.deleted {
+				deleted[id] = struct{}{}
+			}
+		}
+		ix.running++
+		go ix.merge(sources, deleted)
+	}
+}
+
+// merge builds a new segment from a list of adjacent segments without
+// holding any locks and then replaces the source segments.
+func (ix *Index) merge(sources []*segment, deleted map[DocID]struct{}) {
+	merged := buildSegment(sources, deleted)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	// Documents deleted while the merge was running are still in the
+	// merged segment.
+	for _, src := range sources {
+		for id := range src.deleted {
+			if _, ok := deleted[id]; !ok {
+				merged.remove(id)
+			}
+		}
+	}
+	start := 0
+	for start < len(ix.segments) && ix.segments[start] != sources[0] {
+		start++
+	}
+	segments := make([]*segment, 0, len(ix.segments)-len(sources)+1)
+	segments = append(segments, ix.segments[:start]...)
+	if merged.docs > 0 {
+		segments = append(segments, merged)
+	}
+	segments = append(segments, ix.segments[start+len(sources):]...)
+	ix.segments = segments
+
+	ix.running--
+	ix.mergeDone.Broadcast()
+	ix.maybeMerge()
+}
+
+// WaitForMerges blocks until all background merges have finished.
+func (ix *Index) WaitForMerges() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.waitForMerges()
+}
+
+func (ix *Index) waitForMerges() {
+	for ix.running > 0 {
+		ix.mergeDone.Wait()
+	}
+}
+
+func (ix *Index) hasDeletes() bool {
+	for _, seg := range ix.segments {
+		if len(seg.deleted) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func anyMerging(segments []*segment) bool {
+	for _, seg := range segments {
+		if seg.merging {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package ts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestSegments(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2), WithMergePolicy(nil))
+	for i := 0; i < 5; i++ {
+		_, err := ix.AddDocument(fmt.Sprint(i), strings.NewReader(fmt.Sprintf("raft term%d", i)))
+		is.NoErr(err)
+	}
+	is.Equal(len(ix.segments), 2)
+	is.Equal(ix.mem.docs, 1)
+	is.Equal(ix.segments[0].minID, DocID(0))
+	is.Equal(ix.segments[1].maxID, DocID(3))
+	is.Equal(ix.segmentOf(3), ix.segments[1])
+	is.Equal(ix.segmentOf(4), ix.mem)
+
+	res := ix.Search(StringQuery("raft"))
+	is.Equal(len(res), 5)
+	is.True(sort.IsSorted(postingsList(ix.postings(fieldKey(DefaultField, "raft")))))
+
+	is.NoErr(ix.Delete(2))
+	is.Equal(len(ix.segments[1].deleted), 1)
+	is.Equal(len(ix.Search(StringQuery("raft"))), 4)
+	is.Equal(len(ix.Search(StringQuery("term2"))), 0)
+	_, _, postings := termStats(ix, "raft")
+	is.Equal(postings, 5)
+
+	ix.Compact()
+	is.Equal(ix.mem.docs, 0)
+	is.Equal(len(ix.segments), 3)
+	is.Equal(ix.segments[1].docs, 1)
+	_, _, postings = termStats(ix, "raft")
+	is.Equal(postings, 4)
+	is.Equal(len(ix.Search(StringQuery("raft"))), 4)
+}
+
+func TestBackgroundMerge(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	addDocs := func(ix *Index) {
+		for i := 0; i < 8; i++ {
+			_, err := ix.AddDocument(fmt.Sprint(i), strings.NewReader(fmt.Sprintf("raft term%d", i)))
+			is.NoErr(err)
+		}
+		ix.WaitForMerges()
+	}
+
+	// No merge starts until the eighth segment is flushed, which merges
+	// every segment at once.
+	ix := NewIndex(
+		WithFlushThreshold(1),
+		WithMergePolicy(&LogMergePolicy{MergeFactor: 8, MinMergeDocs: 1}),
+	)
+	addDocs(ix)
+	is.Equal(len(ix.segments), 1)
+	is.Equal(ix.segments[0].docs, 8)
+	is.Equal(ix.segments[0].minID, DocID(0))
+	is.Equal(ix.segments[0].maxID, DocID(7))
+	is.Equal(len(ix.Search(StringQuery("raft"))), 8)
+
+	// Merges of merged segments finish in any order, but once they are done
+	// the policy has nothing left to merge and no document is lost.
+	policy := &LogMergePolicy{MergeFactor: 2, MinMergeDocs: 1}
+	ix = NewIndex(WithFlushThreshold(1), WithMergePolicy(policy))
+	addDocs(ix)
+	infos := make([]SegmentInfo, len(ix.segments))
+	next := DocID(0)
+	for i, seg := range ix.segments {
+		infos[i] = seg.info()
+		is.Equal(seg.minID, next)
+		next = seg.maxID + 1
+	}
+	is.Equal(next, DocID(8))
+	is.Equal(policy.FindMerges(infos), []Merge(nil))
+	is.Equal(len(ix.Search(StringQuery("raft"))), 8)
+	is.True(sort.IsSorted(postingsList(ix.postings(fieldKey(DefaultField, "raft")))))
+
+	// Segments with too many deletions are merged on their own to purge
+	// the deleted documents.
+	ix = NewIndex(WithFlushThreshold(4), WithMergePolicy(&TieredMergePolicy{
+		SegmentsPerTier:   10,
+		MaxMergeAtOnce:    10,
+		DeletesPctAllowed: 25,
+	}))
+	for i := 0; i < 4; i++ {
+		_, err := ix.AddDocument(fmt.Sprint(i), strings.NewReader("paxos"))
+		is.NoErr(err)
+	}
+	is.NoErr(ix.Delete(0))
+	is.NoErr(ix.Delete(1))
+	ix.WaitForMerges()
+	is.Equal(len(ix.segments), 1)
+	is.Equal(ix.segments[0].docs, 2)
+	is.Equal(len(ix.segments[0].deleted), 0)
+	freq, docs, postings := termStats(ix, "paxos")
+	is.Equal(freq, 2)
+	is.Equal(docs, 2)
+	is.Equal(postings, 2)
+	is.Equal(len(ix.Search(StringQuery("paxos"))), 2)
+}
+
+func TestMergePolicies(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	segments := func(sizes ...int) []SegmentInfo {
+		infos := make([]SegmentInfo, len(sizes))
+		for i, s := range sizes {
+			infos[i] = SegmentInfo{Docs: s}
+		}
+		return infos
+	}
+
+	lp := &LogMergePolicy{MergeFactor: 3, MinMergeDocs: 1}
+	is.Equal(lp.FindMerges(segments(1, 1)), []Merge(nil))
+	is.Equal(lp.FindMerges(segments(1, 1, 1)), []Merge{{0, 3}})
+	is.Equal(lp.FindMerges(segments(27, 1, 1, 1)), []Merge{{1, 4}})
+	infos := segments(1, 1, 1, 1)
+	infos[1].Merging = true
+	is.Equal(lp.FindMerges(infos), []Merge(nil))
+	// A smaller segment before a larger one is merged with it.
+	lp = &LogMergePolicy{MergeFactor: 2, MinMergeDocs: 1}
+	is.Equal(lp.FindMerges(segments(2, 4, 2)), []Merge{{0, 2}})
+	is.Equal(lp.FindMerges(segments(4, 2, 2)), []Merge{{1, 3}})
+
+	tp := &TieredMergePolicy{
+		SegmentsPerTier:   2,
+		MaxMergeAtOnce:    2,
+		FloorSegmentDocs:  1,
+		DeletesPctAllowed: 50,
+	}
+	is.Equal(tp.FindMerges(segments(10, 10)), []Merge(nil))
+	is.Equal(tp.FindMerges(segments(10, 10, 10, 10, 10)), []Merge{{0, 2}})
+	is.Equal(tp.FindMerges(segments(40, 10, 10, 10, 10, 10)), []Merge{{1, 3}})
+	infos = segments(10, 10)
+	infos[0].Deleted = 6
+	is.Equal(tp.FindMerges(infos), []Merge{{0, 1}})
+}
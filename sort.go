@@ -0,0 +1,144 @@
+package ts
+
+import "sort"
+
+// SortField orders search results by the values of a keyword, numeric or
+// date field. Values are read from the index's per-document columns, so
+// sorting does not load stored documents.
+//
+// A document with several values for the field sorts by its lowest value
+// in ascending order and by its highest value in descending order. Documents
+// without a value, and text fields, which have no sortable value, sort after
+// every value unless MissingFirst is set.
+type SortField struct {
+	Field string
+	// Desc sorts from the highest value to the lowest.
+	Desc bool
+	// MissingFirst sorts documents without a value before every value.
+	MissingFirst bool
+}
+
+// SortBy orders the results of a search by field values instead of rank.
+// Results are compared by each field in turn, then by rank and then by
+// DocID.
+func SortBy(fields ...SortField) SearchOption {
+	return func(so *searchOptions) { so.sort = fields }
+}
+
+// Kinds of sort keys. Numeric values sort before keyword values if a field
+// has both.
+const (
+	missingKey byte = iota
+	numberKey
+	keywordKey
+)
+
+// sortKey is the value of a document for a SortField.
+type sortKey struct {
+	kind byte
+	num  uint64
+	str  string
+}
+
+func compareKeys(a, b sortKey) int {
+	switch {
+	case a.kind != b.kind:
+		if a.kind < b.kind {
+			return -1
+		}
+		return 1
+	case a.kind == numberKey && a.num != b.num:
+		if a.num < b.num {
+			return -1
+		}
+		return 1
+	case a.kind == keywordKey && a.str != b.str:
+		if a.str < b.str {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// ordering orders results by the sort fields of a search. A nil ordering
+// orders results by rank.
+type ordering struct {
+	ix     *Index
+	fields []SortField
+}
+
+// newOrdering returns the ordering of a search, nil if it has no sort
+// fields.
+func (ix *Index) newOrdering(so *searchOptions) *ordering {
+	if len(so.sort) == 0 {
+		return nil
+	}
+	return &ordering{ix: ix, fields: so.sort}
+}
+
+// prepare reads the sort keys of a result.
+func (o *ordering) prepare(r *QueryResult) {
+	if o == nil || r.sortKeys != nil {
+		return
+	}
+	r.sortKeys = make([]sortKey, len(o.fields))
+	for i, f := range o.fields {
+		r.sortKeys[i] = o.ix.sortKey(f, r.DocumentID)
+	}
+}
+
+// sortKey returns the value of a document that it sorts by.
+func (ix *Index) sortKey(f SortField, id DocID) sortKey {
+	if col, ok := ix.numbers[f.Field]; ok {
+		if lo, hi, ok := col.get(id); ok {
+			if f.Desc {
+				return sortKey{kind: numberKey, num: hi}
+			}
+			return sortKey{kind: numberKey, num: lo}
+		}
+	}
+	if col, ok := ix.keywords[f.Field]; ok {
+		ords := col.get(id)
+		if len(ords) == 0 {
+			return sortKey{}
+		}
+		v := col.values[ords[0]]
+		for _, ord := range ords[1:] {
+			if s := col.values[ord]; s < v != f.Desc {
+				v = s
+			}
+		}
+		return sortKey{kind: keywordKey, str: v}
+	}
+	return sortKey{}
+}
+
+// worse reports whether a sorts after b. Results that compare equal by
+// every sort field are ordered by rank and ties are broken by document ID so
+// that results are deterministic.
+func (o *ordering) worse(a, b *QueryResult) bool {
+	if o != nil {
+		for i, f := range o.fields {
+			ka, kb := a.sortKeys[i], b.sortKeys[i]
+			if (ka.kind == missingKey) != (kb.kind == missingKey) {
+				return (ka.kind == missingKey) != f.MissingFirst
+			}
+			if c := compareKeys(ka, kb); c != 0 {
+				return c > 0 != f.Desc
+			}
+		}
+	}
+	if a.Rank != b.Rank {
+		return a.Rank < b.Rank
+	}
+	return a.DocumentID > b.DocumentID
+}
+
+// sort orders results from first to last.
+func (o *ordering) sort(results []*QueryResult) {
+	for _, r := range results {
+		o.prepare(r)
+	}
+	sort.Slice(results, func(i, j int) bool { return o.worse(results[j], results[i]) })
+}
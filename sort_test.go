@@ -0,0 +1,107 @@
+package ts
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestSortBy(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	for _, doc := range []*Document{
+		NewDocument("raft", TextField(DefaultField, "consensus algorithm"),
+			KeywordField("author", "ongaro"), NumericField("year", 2014), NumericField("year", 2013), DateField("read", day(3))),
+		NewDocument("paxos", TextField(DefaultField, "consensus made simple"),
+			KeywordField("author", "lamport"), NumericField("year", 2001), DateField("read", day(1))),
+		NewDocument("vr", TextField(DefaultField, "consensus replication"),
+			KeywordField("author", "oki"), KeywordField("author", "liskov"), NumericField("year", 1988)),
+		NewDocument("notes", TextField(DefaultField, "consensus notes consensus"),
+			NumericField("year", 2001), DateField("read", day(2))),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(res []*QueryResult) []string {
+		out := make([]string, len(res))
+		for i, r := range res {
+			out[i] = r.DocumentName
+		}
+		return out
+	}
+	q := StringQuery("consensus")
+
+	for _, tt := range []struct {
+		sort []SortField
+		want []string
+	}{
+		{[]SortField{{Field: "year"}}, []string{"vr", "notes", "paxos", "raft"}},
+		{[]SortField{{Field: "year", Desc: true}}, []string{"raft", "notes", "paxos", "vr"}},
+		{[]SortField{{Field: "year"}, {Field: "author"}}, []string{"vr", "paxos", "notes", "raft"}},
+		{[]SortField{{Field: "year"}, {Field: "author", MissingFirst: true}}, []string{"vr", "notes", "paxos", "raft"}},
+		{[]SortField{{Field: "author"}}, []string{"paxos", "vr", "raft", "notes"}},
+		{[]SortField{{Field: "author", Desc: true}}, []string{"raft", "vr", "paxos", "notes"}},
+		{[]SortField{{Field: "read", Desc: true}}, []string{"raft", "notes", "paxos", "vr"}},
+		{[]SortField{{Field: "read", MissingFirst: true}}, []string{"vr", "paxos", "notes", "raft"}},
+		// Text fields have no values to sort by, so results are sorted by
+		// rank and then by DocID.
+		{[]SortField{{Field: DefaultField}}, []string{"notes", "raft", "vr", "paxos"}},
+	} {
+		res := ix.Search(q, SortBy(tt.sort...))
+		is.Equal(names(res), tt.want)
+		is.Equal(names(ix.SearchTopK(q, 3, SortBy(tt.sort...))), tt.want[:3])
+	}
+}
+
+func TestSortByPages(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(40))
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 200; i++ {
+		fields := []Field{TextField(DefaultField, zipfText(r, 5+r.Intn(20)))}
+		if r.Intn(4) > 0 {
+			fields = append(fields, NumericField("price", float64(r.Intn(20))))
+		}
+		if r.Intn(4) > 0 {
+			fields = append(fields, KeywordField("color", fmt.Sprint("c", r.Intn(5))))
+		}
+		_, err := ix.Add(NewDocument(fmt.Sprint("doc", i), fields...))
+		is.NoErr(err)
+	}
+	q := Or("w0", "w1", "w2")
+	sortBy := SortBy(SortField{Field: "price", Desc: true}, SortField{Field: "color", MissingFirst: true})
+	all := ix.Search(q, sortBy)
+	is.True(len(all) > 50)
+
+	var (
+		seen []DocID
+		req  = &SearchRequest{Query: q, Size: 7, Options: []SearchOption{sortBy}}
+	)
+	for {
+		resp, err := ix.SearchPage(req)
+		is.NoErr(err)
+		for _, r := range resp.Results {
+			seen = append(seen, r.DocumentID)
+		}
+		if resp.Next == "" {
+			break
+		}
+		req.SearchAfter = resp.Next
+	}
+	is.Equal(len(seen), len(all))
+	for i, r := range all {
+		is.Equal(seen[i], r.DocumentID)
+	}
+
+	// A cursor can only continue a search sorted by the same fields.
+	resp, err := ix.SearchPage(&SearchRequest{Query: q, Size: 7, Options: []SearchOption{sortBy}})
+	is.NoErr(err)
+	_, err = ix.SearchPage(&SearchRequest{Query: q, SearchAfter: resp.Next})
+	is.Equal(err, ErrInvalidCursor)
+}
@@ -1,13 +1,20 @@
 package ts
 
 import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"reflect"
+	"sync"
 	"unsafe"
 )
 
 var (
 	ErrTermNotFound = errors.New("term not found")
+	ErrKeyNotFound  = errors.New("key not found")
 )
 
 type Store interface {
@@ -18,7 +25,8 @@ type Store interface {
 
 func NewMemStore() *MemStore {
 	return &MemStore{
-		terms: make(map[string]*term),
+		terms:  make(map[string]*term),
+		values: make(map[string]interface{}),
 	}
 }
 
@@ -27,7 +35,44 @@ type termStore interface {
 }
 
 type MemStore struct {
-	terms map[string]*term
+	mu     sync.RWMutex
+	terms  map[string]*term
+	values map[string]interface{}
+}
+
+// Get will copy the value stored at key into dest which must be a non-nil
+// pointer to a type that the stored value is assignable to.
+func (ms *MemStore) Get(key string, dest interface{}) error {
+	ms.mu.RLock()
+	v, ok := ms.values[key]
+	ms.mu.RUnlock()
+	if !ok {
+		return ErrKeyNotFound
+	}
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() {
+		return fmt.Errorf("invalid destination %T", dest)
+	}
+	val := reflect.ValueOf(v)
+	if !val.Type().AssignableTo(d.Elem().Type()) {
+		return fmt.Errorf("cannot assign %T to %T", v, dest)
+	}
+	d.Elem().Set(val)
+	return nil
+}
+
+func (ms *MemStore) Put(key string, value interface{}) error {
+	ms.mu.Lock()
+	ms.values[key] = value
+	ms.mu.Unlock()
+	return nil
+}
+
+func (ms *MemStore) Delete(key string) error {
+	ms.mu.Lock()
+	delete(ms.values, key)
+	ms.mu.Unlock()
+	return nil
 }
 
 func (ms *MemStore) get(key string) (*term, error) {
@@ -38,6 +83,101 @@ func (ms *MemStore) get(key string) (*term, error) {
 	return t, nil
 }
 
+var _ Store = (*MemStore)(nil)
+
+// encodeStoredFields serializes and compresses the names and values of a
+// list of fields.
+func encodeStoredFields(fields []Field) ([]byte, error) {
+	// Stored Fields Frame (compressed):
+	// | Count  | Name Length | Name     | Type | Value Length | Value    | ...
+	// | varint | varint      | variable | 1    | varint       | variable | ...
+	var (
+		buf bytes.Buffer
+		n   [binary.MaxVarintLen64]byte
+	)
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	writeString := func(s string) error {
+		l := binary.PutUvarint(n[:], uint64(len(s)))
+		if _, err := w.Write(n[:l]); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, s)
+		return err
+	}
+	l := binary.PutUvarint(n[:], uint64(len(fields)))
+	if _, err = w.Write(n[:l]); err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if err = writeString(f.Name); err != nil {
+			return nil, err
+		}
+		if _, err = w.Write([]byte{byte(f.Type)}); err != nil {
+			return nil, err
+		}
+		if err = writeString(f.formatValue()); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeStoredFields(b []byte) ([]Field, error) {
+	r := flate.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	br := &byteReader{r: r}
+	readString := func() (string, error) {
+		l, err := binary.ReadUvarint(br)
+		if err != nil {
+			return "", err
+		}
+		s := make([]byte, l)
+		if _, err = io.ReadFull(r, s); err != nil {
+			return "", err
+		}
+		return string(s), nil
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]Field, count)
+	for i := range fields {
+		if fields[i].Name, err = readString(); err != nil {
+			return nil, err
+		}
+		typ, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		fields[i].Type = FieldType(typ)
+		if fields[i].Value, err = readString(); err != nil {
+			return nil, err
+		}
+		if err = fields[i].parseValue(); err != nil {
+			return nil, err
+		}
+		fields[i].Stored = true
+	}
+	return fields, nil
+}
+
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(br.r, br.buf[:])
+	return br.buf[0], err
+}
+
 type DiskStore struct{}
 
 func writePosting(w io.Writer, p *posting) (int, error) {
@@ -49,7 +189,7 @@ func writePosting(w io.Writer, p *posting) (int, error) {
 		acc, n int
 		err    error
 	)
-	n, err = writeUint64(w, p.ID)
+	n, err = writeUint64(w, uint64(p.ID))
 	if err != nil {
 		return n, err
 	}
@@ -73,10 +213,11 @@ func readPosting(r io.Reader, p *posting) error {
 	// |    | Length | Values... |
 	// | 8  | 8      | variable  |
 	var err error
-	p.ID, err = readUint64(r)
+	id, err := readUint64(r)
 	if err != nil {
 		return err
 	}
+	p.ID = DocID(id)
 	length, err := readUint64(r)
 	if err != nil {
 		return err
@@ -148,7 +289,7 @@ func serializePosting(p *posting) []byte {
 		bytes = uint(unsafe.Sizeof(p.ID) + unsafe.Sizeof(uint(0)) + uintArraySize(p.Pos))
 		b     = make([]byte, bytes)
 	)
-	k := serializeUint64(p.ID, b, 0)
+	k := serializeUint64(uint64(p.ID), b, 0)
 	k = serializeUint(uint(len(p.Pos)), b, k)
 	serializeUintArray(p.Pos, b, k)
 	return b
@@ -156,9 +297,11 @@ func serializePosting(p *posting) []byte {
 
 func deserializePosting(b []byte, dest *posting, start int) int {
 	var (
+		id     uint64
 		length uint
 	)
-	dest.ID, start = deserializeUint64(b, start)
+	id, start = deserializeUint64(b, start)
+	dest.ID = DocID(id)
 	length, start = deserializeUint(b, start)
 	if uint(len(dest.Pos)) < length {
 		dest.Pos = make([]uint, length)
@@ -0,0 +1,222 @@
+package ts
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxExpansions is the maximum number of terms that a query matching
+// many terms, such as a FuzzyQuery or PrefixQuery, expands to.
+const DefaultMaxExpansions = 50
+
+// scan calls fn with every term key in the segment that starts with prefix
+// in sorted order. Keys start with the name of their field, so the terms of a
+// field that start with a prefix are next to each other in the sorted keys.
+func (seg *segment) scan(prefix string, fn func(key string, t *term)) {
+	keys := seg.sortedKeys()
+	i := sort.SearchStrings(keys, prefix)
+	for ; i < len(keys) && strings.HasPrefix(keys[i], prefix); i++ {
+		fn(keys[i], seg.terms[keys[i]])
+	}
+}
+
+// expansion is a term that a query matching many terms expanded to.
+type expansion struct {
+	token string
+	// Distance of the term from the query, zero for an exact match
+	dist int
+	// Number of live documents containing the term
+	docs int
+}
+
+// matchTerms returns the terms of a field that start with prefix and are
+// accepted by match along with their distance from the query.
+func (ix *Index) matchTerms(field, prefix string, match func(token string) (int, bool)) []expansion {
+	start := fieldKey(field, prefix)
+	return ix.collectTerms(func(seg *segment, emit func(key string, dist int, t *term)) {
+		seg.scan(start, func(key string, t *term) {
+			if d, ok := match(key[len(field)+len(fieldSep):]); ok {
+				emit(key, d, t)
+			}
+		})
+	})
+}
+
+// collectTerms runs a search of the term dictionary over every segment and
+// returns each term that it emits with the number of live documents that
+// contain the term.
+func (ix *Index) collectTerms(search func(seg *segment, emit func(key string, dist int, t *term))) []expansion {
+	var (
+		found = make(map[string]int)
+		res   []expansion
+	)
+	emit := func(key string, dist int, t *term) {
+		if t.docs == 0 {
+			return
+		}
+		_, token := splitFieldKey(key)
+		if i, ok := found[token]; ok {
+			res[i].docs += t.docs
+			return
+		}
+		found[token] = len(res)
+		res = append(res, expansion{token: token, dist: dist, docs: t.docs})
+	}
+	for _, seg := range ix.segments {
+		search(seg, emit)
+	}
+	search(ix.mem, emit)
+	return res
+}
+
+// expand returns the postings of the best expansions of a query. Terms are
+// ranked by distance and then by the number of documents containing them and
+// only the best limit terms are used. Each term is weighted by its distance
+// from the query.
+func expand(ix *Index, field string, terms []expansion, limit int) []*posting {
+	sort.Slice(terms, func(i, j int) bool {
+		a, b := terms[i], terms[j]
+		if a.dist != b.dist {
+			return a.dist < b.dist
+		}
+		if a.docs != b.docs {
+			return a.docs > b.docs
+		}
+		return a.token < b.token
+	})
+	if limit > 0 && len(terms) > limit {
+		terms = terms[:limit]
+	}
+	lists := make([][]*posting, 0, len(terms))
+	for _, t := range terms {
+		postings := ix.termPostings(fieldKey(field, t.token))
+		if t.dist > 0 {
+			weight := 1 / float64(1+t.dist)
+			for _, p := range postings {
+				p.hits[0].weight = weight
+			}
+		}
+		lists = append(lists, postings)
+	}
+	return union(lists)
+}
+
+func exactMatch(string) (int, bool) { return 0, true }
+
+// PrefixQuery matches documents containing a term in the DefaultField that
+// starts with prefix. At most maxExpansions terms are searched, or
+// DefaultMaxExpansions if maxExpansions is not positive, preferring terms that
+// are found in more documents. Documents that only contain the other matching
+// terms are not found.
+func PrefixQuery(prefix string, maxExpansions int) Query {
+	if maxExpansions <= 0 {
+		maxExpansions = DefaultMaxExpansions
+	}
+	return &prefixQuery{
+		field:         DefaultField,
+		prefix:        string(cleanWord(prefix)),
+		maxExpansions: maxExpansions,
+	}
+}
+
+type prefixQuery struct {
+	field, prefix string
+	maxExpansions int
+}
+
+func (pq *prefixQuery) Keys() []string { return []string{pq.prefix} }
+
+func (pq *prefixQuery) String() string { return fieldPrefix(pq.field) + escapeTerm(pq.prefix) + "*" }
+
+func (pq *prefixQuery) search(ix *Index) []*posting {
+	terms := ix.matchTerms(pq.field, pq.prefix, exactMatch)
+	return expand(ix, pq.field, terms, pq.maxExpansions)
+}
+
+// WildcardQuery matches documents containing a term in the DefaultField that
+// matches a pattern where '?' matches any single character and '*' matches
+// any number of characters. Only the terms before the first wildcard need to
+// be scanned so patterns that start with a wildcard are slow. At most
+// maxExpansions terms are searched, or DefaultMaxExpansions if maxExpansions
+// is not positive, preferring terms that are found in more documents.
+func WildcardQuery(pattern string, maxExpansions int) Query {
+	pattern, err := normalize(pattern)
+	if err != nil {
+		pattern = ""
+	}
+	if maxExpansions <= 0 {
+		maxExpansions = DefaultMaxExpansions
+	}
+	return &wildcardQuery{
+		field:         DefaultField,
+		pattern:       strings.ToLower(pattern),
+		maxExpansions: maxExpansions,
+	}
+}
+
+type wildcardQuery struct {
+	field, pattern string
+	maxExpansions  int
+}
+
+func (wq *wildcardQuery) Keys() []string { return nil }
+
+func (wq *wildcardQuery) String() string {
+	return fieldPrefix(wq.field) + escape(wq.pattern, "?*")
+}
+
+func (wq *wildcardQuery) search(ix *Index) []*posting {
+	prefix := wq.pattern
+	if i := strings.IndexAny(prefix, "?*"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	rest := wq.pattern[len(prefix):]
+	terms := ix.matchTerms(wq.field, prefix, func(token string) (int, bool) {
+		return 0, wildcardMatch(rest, token[len(prefix):])
+	})
+	return expand(ix, wq.field, terms, wq.maxExpansions)
+}
+
+// wildcardMatch reports whether s matches a wildcard pattern. When a '*'
+// fails to match it backtracks to the last '*' only, which keeps matching
+// linear in the common case.
+func wildcardMatch(pattern, s string) bool {
+	var (
+		p, i          int
+		star, starPos = -1, 0
+	)
+	for i < len(s) {
+		if p < len(pattern) && pattern[p] == '*' {
+			star, starPos = p, i
+			p++
+			continue
+		}
+		if p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]) {
+			// '?' matches a whole rune rather than a byte.
+			_, size := utf8.DecodeRuneInString(s[i:])
+			if pattern[p] != '?' {
+				size = 1
+			}
+			p++
+			i += size
+			continue
+		}
+		if star < 0 {
+			return false
+		}
+		// Let the last '*' match one more rune.
+		_, size := utf8.DecodeRuneInString(s[starPos:])
+		starPos += size
+		p, i = star+1, starPos
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+var (
+	_ Query = (*prefixQuery)(nil)
+	_ Query = (*wildcardQuery)(nil)
+)
@@ -0,0 +1,99 @@
+package ts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestTermDictionary(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(3), WithMergePolicy(&LogMergePolicy{MergeFactor: 2, MinMergeDocs: 1}))
+	for i := 0; i < 10; i++ {
+		_, err := ix.AddDocument(fmt.Sprint(i), strings.NewReader(fmt.Sprintf("zeta alpha term%d beta", 9-i)))
+		is.NoErr(err)
+	}
+	ix.WaitForMerges()
+	for _, seg := range append(ix.segments, ix.mem) {
+		keys := seg.sortedKeys()
+		is.True(sort.StringsAreSorted(keys))
+		is.Equal(len(keys), len(seg.terms))
+	}
+	var keys []string
+	ix.mem.scan(fieldKey(DefaultField, "term"), func(key string, _ *term) {
+		keys = append(keys, key)
+	})
+	is.Equal(keys, []string{fieldKey(DefaultField, "term0")})
+}
+
+func TestPrefixAndWildcardQueries(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(2))
+	for _, doc := range []*Document{
+		NewDocument("raft", TextField(DefaultField, "raft distributed consensus")),
+		NewDocument("rift", TextField(DefaultField, "a rift between distributors")),
+		NewDocument("draft", TextField(DefaultField, "draft of a distribution plan")),
+		NewDocument("roof", TextField(DefaultField, "roof repair"), TextField("title", "distributed roofs")),
+		NewDocument("café", TextField(DefaultField, "a café near the raft")),
+	} {
+		_, err := ix.Add(doc)
+		is.NoErr(err)
+	}
+	names := func(q Query) []string {
+		res := make([]string, 0)
+		for _, r := range ix.Search(q) {
+			res = append(res, r.DocumentName)
+		}
+		sort.Strings(res)
+		return res
+	}
+	is.Equal(names(PrefixQuery("distrib", 0)), []string{"draft", "raft", "rift"})
+	is.Equal(names(PrefixQuery("Distributed", 0)), []string{"raft"})
+	is.Equal(names(PrefixQuery("zzz", 0)), []string{})
+	is.Equal(names(WildcardQuery("r?ft", 0)), []string{"café", "raft", "rift"})
+	is.Equal(names(WildcardQuery("*raft", 0)), []string{"café", "draft", "raft"})
+	is.Equal(names(WildcardQuery("distribut*s", 0)), []string{"rift"})
+	is.Equal(names(WildcardQuery("caf?", 0)), []string{"café"})
+	is.Equal(names(WildcardQuery("R*", 0)), []string{"café", "raft", "rift", "roof"})
+	is.Equal(names(WildcardQuery("raft", 0)), []string{"café", "raft"})
+
+	is.NoErr(ix.Delete(ix.names["rift"]))
+	is.Equal(names(WildcardQuery("r?ft", 0)), []string{"café", "raft"})
+
+	// raft is in the most documents
+	is.Equal(names(PrefixQuery("r", 1)), []string{"café", "raft"})
+	is.Equal(names(WildcardQuery("r*", 1)), []string{"café", "raft"})
+	is.Equal(names(PrefixQuery("r", 0)), []string{"café", "raft", "roof"})
+}
+
+func TestWildcardMatch(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"?", "", false},
+		{"?", "é", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*b*b*", "abab", true},
+		{"*ab", "aab", true},
+		{"a**", "a", true},
+		{"abc", "abcd", false},
+	} {
+		if m := wildcardMatch(tc.pattern, tc.s); m != tc.match {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tc.pattern, tc.s, m, tc.match)
+		}
+	}
+}
@@ -1,41 +1,224 @@
 package ts
 
 import (
+	"errors"
 	"io"
 	"math"
 	"sort"
+	"strconv"
+	"sync"
 )
 
+// DocID is the unique identifier of a document in an Index.
 type DocID uint64
 
-func NewIndex() *index {
-	return &index{
-		terms:           make(map[string]*term),
+var ErrDocumentNotFound = errors.New("document not found")
+
+// Option configures an Index.
+type Option func(*Index)
+
+// WithAnalyzer sets the Analyzer used to tokenize documents.
+func WithAnalyzer(a Analyzer) Option {
+	return func(ix *Index) { ix.analyzer = a }
+}
+
+// WithFieldAnalyzer sets the Analyzer used to tokenize a specific field.
+func WithFieldAnalyzer(field string, a Analyzer) Option {
+	return func(ix *Index) { ix.fieldAnalyzers[field] = a }
+}
+
+// WithScorer sets the Scorer used to rank search results.
+func WithScorer(s Scorer) Option {
+	return func(ix *Index) { ix.scorer = s }
+}
+
+// WithStore sets the Store that document metadata and stored fields are
+// persisted to.
+func WithStore(s Store) Option {
+	return func(ix *Index) { ix.store = s }
+}
+
+// WithStoredFields sets the fields that are stored for every document.
+func WithStoredFields(fields ...string) Option {
+	return func(ix *Index) {
+		for _, f := range fields {
+			ix.storedFields[f] = struct{}{}
+		}
+	}
+}
+
+// WithMergePolicy sets the MergePolicy used to merge segments in the
+// background. A nil policy disables background merging.
+func WithMergePolicy(p MergePolicy) Option {
+	return func(ix *Index) { ix.mergePolicy = p }
+}
+
+// WithFlushThreshold sets the number of documents buffered in the in-memory
+// segment before it is flushed.
+func WithFlushThreshold(docs int) Option {
+	return func(ix *Index) { ix.flushThreshold = docs }
+}
+
+// DefaultFlushThreshold is the number of documents buffered in memory before
+// they are flushed to a new segment.
+const DefaultFlushThreshold = 1000
+
+// NewIndex creates a new in-memory Index. By default documents are tokenized
+// with the SimpleAnalyzer, ranked with BM25, segments are merged with a
+// TieredMergePolicy and stored fields are kept in a MemStore.
+func NewIndex(opts ...Option) *Index {
+	ix := &Index{
 		documents:       0,
 		documentMaxFreq: make([]float64, 0),
+		documentLength:  make([]float64, 0),
+		documentNorm:    make([]float64, 0),
+		deleted:         make(map[DocID]struct{}),
+		names:           make(map[string]DocID),
+		fields:          make(map[string]struct{}),
+		keywords:        make(map[string]*keywordColumn),
+		numbers:         make(map[string]*numericColumn),
+		fieldAnalyzers:  make(map[string]Analyzer),
+		storedFields:    make(map[string]struct{}),
+		mem:             newSegment(),
+		flushThreshold:  DefaultFlushThreshold,
+		mergePolicy:     NewTieredMergePolicy(),
+		analyzer:        SimpleAnalyzer,
+		scorer:          NewBM25(),
+		store:           NewMemStore(),
+	}
+	ix.mergeDone = sync.NewCond(&ix.mu)
+	for _, o := range opts {
+		o(ix)
 	}
+	return ix
 }
 
-type index struct {
+// Index is an inverted index of documents. An Index is safe for concurrent
+// use. Documents are analyzed before any locks are taken so that searches can
+// run while documents are being ingested, and a document is never visible to
+// a search until all of its terms have been added.
+type Index struct {
+	mu sync.RWMutex
+	// Number of live documents. Deleted documents are not counted.
 	documents       uint64
 	docNames        []string
 	documentMaxFreq []float64
-	// Set of terms.
-	terms map[string]*term
+	// Number of tokens in each document and the total of every live document,
+	// used to normalize scores by document length.
+	documentLength []float64
+	totalLength    float64
+	// Euclidean norm of each document's vector of term frequencies
+	documentNorm []float64
+	// Latest live document for each document name.
+	names map[string]DocID
+	// Names of every field that has been indexed.
+	fields map[string]struct{}
+	// Values of keyword fields keyed by field name.
+	keywords map[string]*keywordColumn
+	// Values of numeric and date fields keyed by field name.
+	numbers map[string]*numericColumn
+	// Tombstones for deleted documents. A deleted document's postings stay
+	// in its segment until the segment is flushed or merged.
+	deleted map[DocID]struct{}
+
+	// Segment that new documents are added to.
+	mem *segment
+	// Flushed segments ordered by document ID.
+	segments []*segment
+	// Number of running background merges
+	running   int
+	mergeDone *sync.Cond
+
+	flushThreshold int
+	mergePolicy    MergePolicy
+
+	analyzer       Analyzer
+	fieldAnalyzers map[string]Analyzer
+	storedFields   map[string]struct{}
+	scorer         Scorer
+	store          Store
 }
 
 type term struct {
 	// Freq is the frequency of the term across all of the documents
 	freq int
+	// Docs is the number of live documents that contain the term
+	docs int
 	// Token is the actual token for which this object indexes
 	token string
+	// Highest frequency of the term in a single document. It is not lowered
+	// when documents are deleted so it is an upper bound.
+	maxFreq int
 	// Postings list
 	postings []*posting
 }
 
 type posting struct {
-	ID  uint64 // document ID
+	ID  DocID  // document ID
 	Pos []uint // term positions in document
+	// Hits are the query terms that the document matched, each of which is
+	// scored on its own. Stored postings have no hits, queries add them to
+	// the postings they return. A posting without hits matches without a
+	// score.
+	hits []hit
+}
+
+// hit is a match of a single query term in a document.
+type hit struct {
+	// Key of the term in the index
+	key string
+	// Number of times the term was found in the document
+	freq int
+	// Every document that a match that is not a single term, such as a
+	// phrase, is found in. Nil for terms of the index.
+	matches []*posting
+	// Weight scales the score of the term. Queries set it to rank some
+	// matches above others. Zero is the same as one.
+	weight float64
+}
+
+func (h *hit) boost() float64 {
+	if h.weight == 0 {
+		return 1
+	}
+	return h.weight
+}
+
+// termHits returns postings with a hit for the term of each posting.
+func termHits(key string, postings []*posting) []*posting {
+	res := make([]*posting, len(postings))
+	for i, p := range postings {
+		res[i] = &posting{ID: p.ID, Pos: p.Pos, hits: []hit{{key: key, freq: len(p.Pos)}}}
+	}
+	return res
+}
+
+// asTerm returns postings that are scored as a single term, such as a
+// phrase, found in every document of the list. The weight of the first hit
+// of each posting is kept.
+func asTerm(key string, postings []*posting) []*posting {
+	res := make([]*posting, len(postings))
+	for i, p := range postings {
+		h := hit{key: key, freq: len(p.Pos), matches: postings}
+		if len(p.hits) > 0 {
+			h.weight = p.hits[0].weight
+		}
+		res[i] = &posting{ID: p.ID, Pos: p.Pos, hits: []hit{h}}
+	}
+	return res
+}
+
+// combineHits returns the hits of several postings for the same document.
+func combineHits(ps ...*posting) []hit {
+	n := 0
+	for _, p := range ps {
+		n += len(p.hits)
+	}
+	res := make([]hit, 0, n)
+	for _, p := range ps {
+		res = append(res, p.hits...)
+	}
+	return res
 }
 
 type postingsList []*posting
@@ -53,126 +236,510 @@ const (
 	minInt  = -maxInt - 1
 )
 
-func (ix *index) addDoc(docname string, r io.Reader) error {
-	return ix.add(docname, newCustomTokenizer(r))
+// AddDocument will tokenize the contents of r with the index's Analyzer and
+// add the resulting terms to the DefaultField of a new document with the
+// given name.
+func (ix *Index) AddDocument(name string, r io.Reader) (DocID, error) {
+	doc, err := ix.parseText(name, r)
+	if err != nil {
+		return 0, err
+	}
+	return ix.addParsed(doc)
 }
 
-func (ix *index) add(name string, tokens tokenizer) error {
-	var (
-		max   = minInt
-		docID = ix.documents
-	)
-	for {
-		tok, err := tokens.Next()
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return err
-			}
+// Add will analyze every field of a document and add it to the index.
+func (ix *Index) Add(d *Document) (DocID, error) {
+	doc, err := ix.parseDoc(d)
+	if err != nil {
+		return 0, err
+	}
+	return ix.addParsed(doc)
+}
+
+// Upsert adds a document to the index replacing any live document that was
+// previously added with the same name. If the new document cannot be
+// analyzed the previous version is left untouched.
+func (ix *Index) Upsert(name string, r io.Reader) (DocID, error) {
+	doc, err := ix.parseText(name, r)
+	if err != nil {
+		return 0, err
+	}
+	return ix.upsert(doc)
+}
+
+// UpsertDocument is the same as Upsert but for documents with multiple
+// fields.
+func (ix *Index) UpsertDocument(d *Document) (DocID, error) {
+	doc, err := ix.parseDoc(d)
+	if err != nil {
+		return 0, err
+	}
+	return ix.upsert(doc)
+}
+
+func (ix *Index) upsert(doc *parsedDoc) (DocID, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	prev, replace := ix.names[doc.name]
+	id, err := ix.insert(doc)
+	if err != nil {
+		return id, err
+	}
+	if replace {
+		err = ix.delete(prev)
+	}
+	return id, err
+}
+
+// DocumentID returns the ID of the latest live document added with the given
+// name.
+func (ix *Index) DocumentID(name string) (DocID, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	id, ok := ix.names[name]
+	if !ok {
+		return 0, ErrDocumentNotFound
+	}
+	return id, nil
+}
+
+// DocumentCount returns the number of documents in the index.
+func (ix *Index) DocumentCount() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return int(ix.documents)
+}
+
+// DocumentName returns the name that a document was added with.
+func (ix *Index) DocumentName(id DocID) (string, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if !ix.exists(id) {
+		return "", ErrDocumentNotFound
+	}
+	return ix.docNames[id], nil
+}
+
+// Delete removes a document from the index. The document is excluded from
+// search results immediately but its postings are only removed from the
+// index when its segment is merged or by Compact.
+func (ix *Index) Delete(id DocID) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.exists(id) {
+		return ErrDocumentNotFound
+	}
+	return ix.delete(id)
+}
+
+func (ix *Index) delete(id DocID) error {
+	ix.deleted[id] = struct{}{}
+	if latest, ok := ix.names[ix.docNames[id]]; ok && latest == id {
+		delete(ix.names, ix.docNames[id])
+	}
+	ix.documents--
+	ix.totalLength -= ix.documentLength[id]
+	seg := ix.segmentOf(id)
+	seg.remove(id)
+	if seg != ix.mem {
+		ix.maybeMerge()
+	}
+	if ix.store != nil {
+		if err := ix.store.Delete(documentKey(id)); err != nil {
+			return err
+		}
+		return ix.store.Delete(storedFieldsKey(id))
+	}
+	return nil
+}
+
+// Compact flushes the in-memory segment and purges the postings of deleted
+// documents from every segment.
+func (ix *Index) Compact() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.flush()
+	ix.waitForMerges()
+	segments := ix.segments[:0]
+	for _, seg := range ix.segments {
+		if len(seg.deleted) > 0 && !seg.merging {
+			seg = buildSegment([]*segment{seg}, seg.deleted)
 		}
-		freq := ix.addToken(tok.text, tok.pos, docID, name)
-		if freq > max {
-			max = freq
+		if seg.docs > 0 {
+			segments = append(segments, seg)
 		}
 	}
-	ix.docNames = append(ix.docNames, name)
-	ix.documents++
-	if max == minInt {
-		max = 1
+	ix.segments = segments
+}
+
+func (ix *Index) exists(id DocID) bool {
+	return int(id) < len(ix.docNames) && !ix.isDeleted(id)
+}
+
+func (ix *Index) isDeleted(id DocID) bool {
+	_, ok := ix.deleted[id]
+	return ok
+}
+
+func (ix *Index) add(name string, tokens Tokenizer) (DocID, error) {
+	doc, err := parseTokens(name, tokens)
+	if err != nil {
+		return 0, err
+	}
+	return ix.addParsed(doc)
+}
+
+func (ix *Index) addParsed(doc *parsedDoc) (DocID, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.insert(doc)
+}
+
+// insert stores and indexes a document. If the document cannot be stored it
+// is not indexed.
+func (ix *Index) insert(doc *parsedDoc) (DocID, error) {
+	docID := DocID(len(ix.docNames))
+	if err := ix.storeDoc(docID, doc); err != nil {
+		ix.unstoreDoc(docID)
+		return docID, err
+	}
+	ix.index(docID, doc)
+	return docID, nil
+}
+
+// storeDoc writes the name and stored fields of a document to the store.
+func (ix *Index) storeDoc(id DocID, doc *parsedDoc) error {
+	if ix.store == nil {
+		return nil
+	}
+	if err := ix.store.Put(documentKey(id), doc.name); err != nil {
+		return err
 	}
-	ix.documentMaxFreq = append(ix.documentMaxFreq, float64(max))
-	for _, term := range ix.terms {
-		sort.Sort(postingsList(term.postings))
+	if doc.stored != nil {
+		return ix.store.Put(storedFieldsKey(id), doc.stored)
 	}
 	return nil
 }
 
-// addToken will take a token from a document at some position in the document
-// and add it to the index while collecting all relevant information. Returns
-// the new frequency of that token in the index.
-func (ix *index) addToken(
-	token string,
-	position uint,
-	docID uint64,
-	docname string,
-) int {
-	t, ok := ix.terms[token]
-	if !ok {
-		t = &term{
-			freq:  1,
-			token: token,
-			// Postings list should have no more elements
-			// than the number of documents indexed.
-			postings: make([]*posting, 0, ix.documents),
-		}
-		ix.terms[token] = t
-	} else {
-		t.freq += 1
+// unstoreDoc removes what storeDoc wrote for a document that was not
+// indexed. Errors are ignored since the keys may not have been written.
+func (ix *Index) unstoreDoc(id DocID) {
+	if ix.store != nil {
+		_ = ix.store.Delete(documentKey(id))
+		_ = ix.store.Delete(storedFieldsKey(id))
 	}
-	// Add or append to postings list
-	i, ok := t.findPostingByDocID(docID)
-	if !ok {
-		t.postings = append(t.postings, &posting{ID: docID, Pos: []uint{position}})
-	} else {
-		t.postings[i].Pos = append(t.postings[i].Pos, position)
+}
+
+// index adds a document to the in-memory segment and the per-document
+// statistics under the next DocID, which must be docID.
+func (ix *Index) index(docID DocID, doc *parsedDoc) {
+	ix.mem.add(docID, doc)
+	for _, f := range doc.fields {
+		ix.fields[f] = struct{}{}
 	}
-	return t.freq
+	for f, values := range doc.keywords {
+		col, ok := ix.keywords[f]
+		if !ok {
+			col = newKeywordColumn()
+			ix.keywords[f] = col
+		}
+		col.add(docID, values)
+	}
+	for f, values := range doc.numbers {
+		col, ok := ix.numbers[f]
+		if !ok {
+			col = newNumericColumn()
+			ix.numbers[f] = col
+		}
+		col.add(docID, values)
+	}
+	ix.names[doc.name] = docID
+	ix.docNames = append(ix.docNames, doc.name)
+	ix.documents++
+	ix.documentMaxFreq = append(ix.documentMaxFreq, float64(doc.maxFreq))
+	ix.documentLength = append(ix.documentLength, float64(doc.length))
+	ix.totalLength += float64(doc.length)
+	ix.documentNorm = append(ix.documentNorm, math.Sqrt(float64(doc.sumSquares)))
+	if ix.mem.docs >= ix.flushThreshold {
+		ix.flush()
+	}
+}
+
+func documentKey(id DocID) string {
+	return "doc:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func storedFieldsKey(id DocID) string {
+	return documentKey(id) + ":fields"
+}
+
+// Document returns a document with its stored fields. Fields that were not
+// stored are not returned.
+func (ix *Index) Document(id DocID) (*Document, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if !ix.exists(id) {
+		return nil, ErrDocumentNotFound
+	}
+	fields, err := ix.loadFields(id)
+	if err != nil {
+		return nil, err
+	}
+	return NewDocument(ix.docNames[id], fields...), nil
+}
+
+func (ix *Index) loadFields(id DocID) ([]Field, error) {
+	if ix.store == nil {
+		return nil, nil
+	}
+	var b []byte
+	err := ix.store.Get(storedFieldsKey(id), &b)
+	if err == ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodeStoredFields(b)
 }
 
 // Find the index of a posting given the document ID.
 // If a result is not found, it will return `false` in the second return value.
-func (t *term) findPostingByDocID(docID uint64) (int, bool) {
+func (t *term) findPostingByDocID(docID DocID) (int, bool) {
 	n := len(t.postings)
 	i := sort.Search(n, func(i int) bool {
-		return t.postings[i].ID == docID
+		return t.postings[i].ID >= docID
 	})
-	if i == n {
+	if i == n || t.postings[i].ID != docID {
 		return -1, false
 	}
 	return i, true
 }
 
-func (ix *index) Search(query Query) []*QueryResult {
-	var (
-		tokens   = query.Keys()
-		postings = make([][]*posting, 0, len(tokens))
-	)
-	for _, key := range tokens {
-		term, ok := ix.terms[key]
-		if !ok {
-			continue
-		}
-		postings = append(postings, term.postings)
-	}
+// Search returns the documents matching query ordered by rank. Stored fields
+// that fail to load are left out of the results.
+func (ix *Index) Search(query Query, opts ...SearchOption) []*QueryResult {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.search(query, newSearchOptions(opts))
+}
+
+// search must be called with the lock held.
+func (ix *Index) search(query Query, so *searchOptions) []*QueryResult {
+	postings := query.search(ix)
 	if len(postings) == 0 {
 		return nil
 	}
-	result := ix.tfIdf(query.Join(postings))
-	sort.Sort(QueryResults(result))
+	result := ix.score(postings, so)
+	if order := ix.newOrdering(so); order != nil {
+		order.sort(result)
+	} else {
+		sort.Sort(QueryResults(result))
+	}
+	ix.decorate(query, result, so)
 	return result
 }
 
-// Term frequency - inverse document frequency
-func (ix *index) tfIdf(postings []*posting) []*QueryResult {
-	var (
-		result = make([]*QueryResult, 0)
-		idf    = math.Log2(float64(ix.documents) / float64(len(postings)))
-	)
+// decorate adds the stored fields and snippets that a search asked for to
+// its results.
+func (ix *Index) decorate(query Query, result []*QueryResult, so *searchOptions) {
+	if so.fields != nil {
+		for _, r := range result {
+			ix.loadResultFields(r, so.fields)
+		}
+	}
+	if so.highlight != nil {
+		for _, r := range result {
+			ix.highlight(r, query, so.highlight)
+		}
+	}
+}
+
+func (ix *Index) loadResultFields(r *QueryResult, include map[string]struct{}) {
+	fields, err := ix.loadFields(r.DocumentID)
+	if err != nil || len(fields) == 0 {
+		return
+	}
+	r.Fields = make(map[string]string, len(fields))
+	for _, f := range fields {
+		if _, ok := include[f.Name]; !ok && len(include) > 0 {
+			continue
+		}
+		if _, ok := r.Fields[f.Name]; !ok {
+			r.Fields[f.Name] = f.Value
+		}
+	}
+}
+
+// score ranks the documents of a postings list with the search's Scorer or
+// the index's Scorer if the search did not set one. Each query term that a
+// document matched is scored with its own statistics and the rank is the sum
+// of the term scores.
+func (ix *Index) score(postings []*posting, so *searchOptions) []*QueryResult {
+	if len(ix.mem.deleted) > 0 || ix.hasDeletes() {
+		postings = ix.live(postings)
+	}
+	sc := ix.newScoring(so)
+	for _, p := range postings {
+		for _, h := range p.hits {
+			sc.addTerm(ix, h.key, h.matches)
+		}
+	}
+	result := make([]*QueryResult, 0, len(postings))
 	for _, p := range postings {
-		l := len(p.Pos)
-		tf := float64(l) / ix.documentMaxFreq[p.ID]
-		rank := tf * idf
-		result = append(result, &QueryResult{
-			DocumentName: ix.docNames[p.ID],
-			DocumentID:   p.ID,
-			TokenCount:   l,
-			Rank:         rank,
-		})
+		result = append(result, sc.result(ix, p))
 	}
 	return result
 }
 
+// scoring holds the statistics shared by every document of a search.
+type scoring struct {
+	scorer  Scorer
+	explain bool
+	stats   TermStats
+	// Set when the statistics leave out documents added after maxID
+	snapshot bool
+	maxID    DocID
+	// Document frequency of each term of the query
+	docFreqs map[string]int
+	// Number of terms that stats.QueryNorm was computed from
+	normTerms int
+}
+
+func (ix *Index) newScoring(so *searchOptions) *scoring {
+	sc := &scoring{
+		scorer:   ix.scorer,
+		explain:  so.explain,
+		stats:    TermStats{DocCount: int(ix.documents)},
+		docFreqs: make(map[string]int),
+	}
+	if so.scorer != nil {
+		sc.scorer = so.scorer
+	}
+	totalLength := ix.totalLength
+	if so.snapshot != nil {
+		sc.snapshot, sc.maxID = true, *so.snapshot
+		docs, length := ix.liveAfter(sc.maxID)
+		sc.stats.DocCount -= docs
+		totalLength -= length
+	}
+	if sc.stats.DocCount > 0 {
+		sc.stats.AvgDocLen = totalLength / float64(sc.stats.DocCount)
+	}
+	return sc
+}
+
+// addTerm adds a term of the query and returns its document frequency. The
+// document frequency of a term of the index is looked up, otherwise the live
+// documents in matches are counted.
+func (sc *scoring) addTerm(ix *Index, key string, matches []*posting) int {
+	if df, ok := sc.docFreqs[key]; ok {
+		return df
+	}
+	var docFreq int
+	switch {
+	case matches != nil:
+		if sc.snapshot {
+			matches = upTo(matches, sc.maxID)
+		}
+		for _, p := range matches {
+			if !ix.isDeleted(p.ID) {
+				docFreq++
+			}
+		}
+	case sc.snapshot:
+		docFreq = ix.docFreq(key) - ix.docFreqAfter(key, sc.maxID)
+	default:
+		docFreq = ix.docFreq(key)
+	}
+	sc.docFreqs[key] = docFreq
+	return docFreq
+}
+
+// termStats returns the statistics shared by every term of the query. The
+// query norm is summed in key order so it does not depend on the order that
+// the terms were added in.
+func (sc *scoring) termStats() TermStats {
+	if sc.normTerms != len(sc.docFreqs) {
+		keys := make([]string, 0, len(sc.docFreqs))
+		for key := range sc.docFreqs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var normSq float64
+		for _, key := range keys {
+			idf := smoothIDF(sc.stats.DocCount, sc.docFreqs[key])
+			normSq += idf * idf
+		}
+		sc.stats.QueryNorm = math.Sqrt(normSq)
+		sc.normTerms = len(sc.docFreqs)
+	}
+	return sc.stats
+}
+
+// result scores a document. Every term of the query must have been added.
+func (sc *scoring) result(ix *Index, p *posting) *QueryResult {
+	r := &QueryResult{
+		DocumentName: ix.docNames[p.ID],
+		DocumentID:   p.ID,
+		TokenCount:   len(p.Pos),
+	}
+	if sc.explain {
+		r.Explanation = &Explanation{Description: "sum of:"}
+	}
+	stats := sc.termStats()
+	stats.MaxFreq = ix.documentMaxFreq[p.ID]
+	stats.DocLen = ix.documentLength[p.ID]
+	stats.DocNorm = ix.documentNorm[p.ID]
+	// Scores are summed in the same order however the hits were collected
+	// so that a document's rank is the same on every search.
+	sortHits(p.hits)
+	for _, h := range p.hits {
+		stats.Freq = h.freq
+		stats.DocFreq = sc.docFreqs[h.key]
+		score := sc.scorer.Score(&stats)
+		r.Rank += score * h.boost()
+		if sc.explain {
+			r.Explanation.Details = append(r.Explanation.Details,
+				explainTerm(sc.scorer, h.key, &stats, score, h.boost()))
+		}
+	}
+	if sc.explain {
+		r.Explanation.Value = r.Rank
+	}
+	return r
+}
+
+// sortHits orders hits by key, then by weight and then by frequency. Lists of
+// hits are short so an insertion sort is used.
+func sortHits(hits []hit) {
+	for i := 1; i < len(hits); i++ {
+		for j := i; j > 0 && hitLess(hits[j], hits[j-1]); j-- {
+			hits[j], hits[j-1] = hits[j-1], hits[j]
+		}
+	}
+}
+
+func hitLess(a, b hit) bool {
+	if a.key != b.key {
+		return a.key < b.key
+	}
+	if a.boost() != b.boost() {
+		return a.boost() < b.boost()
+	}
+	return a.freq < b.freq
+}
+
+// live filters out the postings of deleted documents.
+func (ix *Index) live(postings []*posting) []*posting {
+	res := make([]*posting, 0, len(postings))
+	for _, p := range postings {
+		if !ix.isDeleted(p.ID) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
 func levenshtein(s, t string) int {
 	var (
 		i, j int
@@ -204,3 +771,99 @@ func levenshtein(s, t string) int {
 	}
 	return d[m][n]
 }
+
+// boundedLevenshtein returns the edit distance between s and t if it is no
+// more than max. Only the diagonal band of the matrix that can hold a
+// distance within max is filled and it stops as soon as every cell in a row
+// is over max.
+func boundedLevenshtein(s, t []rune, max int) (int, bool) {
+	return boundedEdits(s, t, max, false)
+}
+
+// boundedPrefixLevenshtein returns the smallest edit distance between s and
+// any prefix of t if it is no more than max.
+func boundedPrefixLevenshtein(s, t []rune, max int) (int, bool) {
+	return boundedEdits(s, t, max, true)
+}
+
+func boundedEdits(s, t []rune, max int, prefix bool) (int, bool) {
+	m, n := len(s), len(t)
+	if m-n > max || n-m > max && !prefix {
+		return 0, false
+	}
+	var (
+		over = max + 1
+		prev = make([]int, n+1)
+		cur  = make([]int, n+1)
+	)
+	for j := range prev {
+		prev[j] = j
+		if j > max {
+			prev[j] = over
+		}
+	}
+	for i := 1; i <= m; i++ {
+		lo, hi := i-max, i+max
+		if lo < 1 {
+			lo = 1
+		}
+		if hi > n {
+			hi = n
+		}
+		cur[0] = i
+		if lo > 1 {
+			cur[lo-1] = over
+		}
+		best := cur[0]
+		if lo > 1 {
+			best = over
+		}
+		for j := lo; j <= hi; j++ {
+			d := prev[j-1]
+			if s[i-1] != t[j-1] {
+				d++
+				if prev[j]+1 < d {
+					d = prev[j] + 1
+				}
+				if cur[j-1]+1 < d {
+					d = cur[j-1] + 1
+				}
+			}
+			if d > over {
+				d = over
+			}
+			cur[j] = d
+			if d < best {
+				best = d
+			}
+		}
+		if hi < n {
+			cur[hi+1] = over
+		}
+		if best > max {
+			return 0, false
+		}
+		prev, cur = cur, prev
+	}
+	if prefix {
+		// Any cell of the last row outside of the band is over max.
+		best, hi := over, m+max
+		if hi > n {
+			hi = n
+		}
+		lo := m - max
+		if lo < 0 {
+			lo = 0
+		}
+		for j := lo; j <= hi; j++ {
+			if prev[j] < best {
+				best = prev[j]
+			}
+		}
+		return best, best <= max
+	}
+	if prev[n] > max {
+		return 0, false
+	}
+	return prev[n], true
+}
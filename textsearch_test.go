@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"embed"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -44,7 +47,7 @@ func Test(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if err = index.add(name, toks); err != nil {
+		if _, err = index.add(name, toks); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -114,7 +117,7 @@ func TestKIntersect(t *testing.T) {
 	}
 	res := kIntersect(postings)
 	is.Equal(len((res)), 1) // only has one document
-	is.Equal(res[0].ID, uint64(0))
+	is.Equal(res[0].ID, DocID(0))
 	is.Equal(len(res[0].Pos), 2)
 	is.Equal(res[0].Pos[0], uint(1))
 	is.Equal(res[0].Pos[1], uint(3))
@@ -129,13 +132,9 @@ func TestKIntersect(t *testing.T) {
 		},
 	}
 	res = kIntersect(postings)
-	// fmt.Printf("%+v\n", res)
-	// fmt.Printf("%+v\n", intersect(postings[0], postings[1]))
-	is.Equal(len(res), 2)
-	is.Equal(res[0].ID, uint64(1))
-	is.Equal(res[0].Pos, []uint{1, 2})
-	is.Equal(res[1].ID, uint64(0))
-	is.Equal(res[1].Pos, []uint{0, 8, 1, 7})
+	is.Equal(len(res), 1) // document 1 is only in the first list
+	is.Equal(res[0].ID, DocID(0))
+	is.Equal(res[0].Pos, []uint{0, 8, 1, 7})
 
 	// res = intersect(
 	// 	[]*posting{
@@ -147,14 +146,277 @@ func TestKIntersect(t *testing.T) {
 	// 	},
 	// )
 	// is.Equal(len(res), 2)
-	// is.Equal(res[0].ID, uint64(1))
+	// is.Equal(res[0].ID, DocID(1))
 	// is.Equal(res[0].Pos, []uint{1, 2})
-	// is.Equal(res[1].ID, uint64(0))
+	// is.Equal(res[1].ID, DocID(0))
 	// is.Equal(res[1].Pos, []uint{0, 8, 1, 7})
 }
 
 func TestIntersect(t *testing.T) {}
 
+func TestIndex(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	store := NewMemStore()
+	ix := NewIndex(WithStore(store), WithScorer(TFIDF{}))
+	id, err := ix.AddDocument("one", strings.NewReader("raft is a consensus algorithm"))
+	is.NoErr(err)
+	is.Equal(id, DocID(0))
+	id, err = ix.AddDocument("two", strings.NewReader("paxos is another consensus algorithm"))
+	is.NoErr(err)
+	is.Equal(id, DocID(1))
+	is.Equal(ix.DocumentCount(), 2)
+
+	name, err := ix.DocumentName(1)
+	is.NoErr(err)
+	is.Equal(name, "two")
+	_, err = ix.DocumentName(2)
+	is.Equal(err, ErrDocumentNotFound)
+	is.NoErr(store.Get(documentKey(0), &name))
+	is.Equal(name, "one")
+
+	res := ix.Search(StringQuery("raft"))
+	is.Equal(len(res), 1)
+	is.Equal(res[0].DocumentID, DocID(0))
+	is.Equal(res[0].DocumentName, "one")
+	is.Equal(len(ix.Search(StringQuery("consensus"))), 2)
+}
+
+func TestDelete(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex()
+	for _, body := range []string{
+		"bitcoin blockchain",
+		"bitcoin bitcoin mining",
+		"blockchain ledger",
+	} {
+		_, err := ix.AddDocument(body, strings.NewReader(body))
+		is.NoErr(err)
+	}
+	is.NoErr(ix.Delete(1))
+	is.Equal(ix.Delete(1), ErrDocumentNotFound)
+	is.Equal(ix.Delete(10), ErrDocumentNotFound)
+	is.Equal(ix.DocumentCount(), 2)
+	_, err := ix.DocumentName(1)
+	is.Equal(err, ErrDocumentNotFound)
+
+	freq, docs, postings := termStats(ix, "bitcoin")
+	is.Equal(freq, 1)
+	is.Equal(docs, 1)
+	is.Equal(postings, 2) // not purged yet
+	res := ix.Search(StringQuery("bitcoin"))
+	is.Equal(len(res), 1)
+	is.Equal(res[0].DocumentID, DocID(0))
+	is.Equal(len(ix.Search(StringQuery("mining"))), 0)
+
+	ix.Compact()
+	_, _, postings = termStats(ix, "bitcoin")
+	is.Equal(postings, 1)
+	_, _, postings = termStats(ix, "mining")
+	is.Equal(postings, 0)
+	res = ix.Search(StringQuery("bitcoin"))
+	is.Equal(len(res), 1)
+	is.Equal(res[0].DocumentID, DocID(0))
+
+	id, err := ix.AddDocument("new", strings.NewReader("mining"))
+	is.NoErr(err)
+	is.Equal(id, DocID(3)) // ids are never reused
+}
+
+func TestUpsert(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex()
+	_, err := ix.Upsert("doc", strings.NewReader("raft consensus consensus"))
+	is.NoErr(err)
+	_, err = ix.AddDocument("other", strings.NewReader("consensus"))
+	is.NoErr(err)
+	id, err := ix.Upsert("doc", strings.NewReader("paxos consensus"))
+	is.NoErr(err)
+	is.Equal(id, DocID(2))
+	is.Equal(ix.DocumentCount(), 2)
+	docID, err := ix.DocumentID("doc")
+	is.NoErr(err)
+	is.Equal(docID, id)
+
+	is.Equal(len(ix.Search(StringQuery("raft"))), 0)
+	res := ix.Search(StringQuery("paxos"))
+	is.Equal(len(res), 1)
+	is.Equal(res[0].DocumentID, id)
+	is.Equal(len(ix.Search(StringQuery("consensus"))), 2)
+	freq, docs, _ := termStats(ix, "consensus")
+	is.Equal(freq, 2)
+	is.Equal(docs, 2)
+	freq, _, _ = termStats(ix, "raft")
+	is.Equal(freq, 0)
+
+	// A failed analysis leaves the previous version in place.
+	_, err = ix.Upsert("doc", &errReader{data: "leader election"})
+	is.True(err != nil)
+	docID, err = ix.DocumentID("doc")
+	is.NoErr(err)
+	is.Equal(docID, id)
+	is.Equal(len(ix.Search(StringQuery("leader"))), 0)
+	is.Equal(len(ix.Search(StringQuery("paxos"))), 1)
+}
+
+func TestConcurrentIndex(t *testing.T) {
+	t.Parallel()
+	const (
+		writers = 4
+		readers = 4
+		docs    = 50
+	)
+	var (
+		ix       = NewIndex(WithStore(NewMemStore()), WithFlushThreshold(5))
+		done     = make(chan struct{})
+		wwg, rwg sync.WaitGroup
+	)
+	for w := 0; w < writers; w++ {
+		wwg.Add(1)
+		go func(w int) {
+			defer wwg.Done()
+			for i := 0; i < docs; i++ {
+				name := fmt.Sprintf("doc-%d-%d", w, i%10)
+				body := fmt.Sprintf("marker marker word%d", i)
+				id, err := ix.Upsert(name, strings.NewReader(body))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if i%7 == 0 {
+					if err = ix.Delete(id); err != nil {
+						t.Error(err)
+					}
+				}
+				if i%20 == 0 {
+					ix.Compact()
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		rwg.Add(1)
+		go func() {
+			defer rwg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, res := range ix.Search(StringQuery("marker")) {
+					if res.TokenCount != 2 {
+						t.Errorf("partially indexed document: %+v", res)
+					}
+				}
+				ix.DocumentCount()
+			}
+		}()
+	}
+	wwg.Wait()
+	close(done)
+	rwg.Wait()
+	ix.WaitForMerges()
+
+	res := ix.Search(StringQuery("marker"))
+	if len(res) != ix.DocumentCount() {
+		t.Errorf("got %d results, want %d", len(res), ix.DocumentCount())
+	}
+	seen := make(map[string]bool)
+	for _, r := range res {
+		if seen[r.DocumentName] {
+			t.Errorf("duplicate document %q", r.DocumentName)
+		}
+		seen[r.DocumentName] = true
+	}
+}
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex()
+	_, err := ix.AddDocument("first", strings.NewReader("leader election"))
+	is.NoErr(err)
+	data, filenames := getTestData(t)
+	b := ix.NewBatch()
+	for _, filename := range filenames {
+		f, err := data.Open(filename)
+		is.NoErr(err)
+		is.NoErr(b.Add(filename, f))
+		f.Close()
+	}
+	is.Equal(b.Len(), len(filenames))
+	is.Equal(ix.DocumentCount(), 1) // nothing is added until Apply
+	ids, err := ix.Apply(b)
+	is.NoErr(err)
+	is.Equal(len(ids), len(filenames))
+	for i, id := range ids {
+		is.Equal(id, DocID(i+1))
+		name, err := ix.DocumentName(id)
+		is.NoErr(err)
+		is.Equal(name, filenames[i])
+	}
+	for _, term := range ix.mem.terms {
+		is.True(sort.IsSorted(postingsList(term.postings)))
+	}
+	res := ix.Search(StringQuery("leader"))
+	is.True(len(res) > 1)
+	b.Reset()
+	is.Equal(b.Len(), 0)
+}
+
+func TestBatchStoreError(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	store := &failingStore{MemStore: NewMemStore(), failAt: 3}
+	ix := NewIndex(WithStore(store))
+	b := ix.NewBatch()
+	for _, text := range []string{"leader election", "log replication", "leader lease"} {
+		is.NoErr(b.Add(text, strings.NewReader(text)))
+	}
+	ids, err := ix.Apply(b)
+	is.Equal(err, errStoreFull)
+	is.Equal(len(ids), 0)
+	is.Equal(ix.DocumentCount(), 0)
+	is.Equal(len(ix.Search(StringQuery("leader"))), 0)
+	is.Equal(len(store.values), 0) // written documents are removed
+
+	store.failAt = -1
+	ids, err = ix.Apply(b)
+	is.NoErr(err)
+	is.Equal(ids, []DocID{0, 1, 2})
+	is.Equal(len(ix.Search(StringQuery("leader"))), 2)
+}
+
+var errStoreFull = errors.New("store is full")
+
+// failingStore fails the failAt'th Put, counting from 1.
+type failingStore struct {
+	*MemStore
+	puts, failAt int
+}
+
+func (fs *failingStore) Put(key string, value interface{}) error {
+	fs.puts++
+	if fs.puts == fs.failAt {
+		return errStoreFull
+	}
+	return fs.MemStore.Put(key, value)
+}
+
+type errReader struct{ data string }
+
+func (er *errReader) Read(b []byte) (int, error) {
+	if len(er.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(b, er.data)
+	er.data = er.data[n:]
+	return n, nil
+}
+
 func TestLevenshtein(t *testing.T) {
 	t.Parallel()
 	for _, tc := range []struct {
@@ -180,7 +442,30 @@ func TestLevenshtein(t *testing.T) {
 		if l != tc.Exp {
 			t.Errorf("%q, %q: got %d, want %d", tc.A, tc.B, l, tc.Exp)
 		}
+		for max := 0; max <= tc.Exp+1; max++ {
+			l, ok := boundedLevenshtein([]rune(tc.A), []rune(tc.B), max)
+			if ok != (tc.Exp <= max) || ok && l != tc.Exp {
+				t.Errorf("%q, %q within %d: got %d, %v", tc.A, tc.B, max, l, ok)
+			}
+		}
+	}
+}
+
+// termStats sums the statistics of a term in the DefaultField across every
+// segment.
+func termStats(ix *Index, token string) (freq, docs, postings int) {
+	key := fieldKey(DefaultField, token)
+	segments := make([]*segment, 0, len(ix.segments)+1)
+	segments = append(segments, ix.segments...)
+	segments = append(segments, ix.mem)
+	for _, seg := range segments {
+		if t, ok := seg.terms[key]; ok {
+			freq += t.freq
+			docs += t.docs
+			postings += len(t.postings)
+		}
 	}
+	return freq, docs, postings
 }
 
 func printTerms(terms map[string]*term) {
@@ -210,6 +495,47 @@ func BenchmarkSearch(b *testing.B) {
 	}
 }
 
+// BenchmarkIngest indexes the test corpus repeated a growing number of times.
+// The time per document should stay flat as the index grows.
+func BenchmarkIngest(b *testing.B) {
+	bodies := getTestBodies(b)
+	for _, copies := range []int{1, 4, 16} {
+		n := copies * len(bodies)
+		b.Run(fmt.Sprintf("AddDocument/docs=%d", n), func(b *testing.B) {
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				ix := NewIndex()
+				for c := 0; c < copies; c++ {
+					for _, body := range bodies {
+						if _, err := ix.AddDocument("", bytes.NewReader(body)); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			}
+			b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*n), "ns/doc")
+		})
+		b.Run(fmt.Sprintf("Batch/docs=%d", n), func(b *testing.B) {
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				ix := NewIndex()
+				batch := ix.NewBatch()
+				for c := 0; c < copies; c++ {
+					for _, body := range bodies {
+						if err := batch.Add("", bytes.NewReader(body)); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+				if _, err := ix.Apply(batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*n), "ns/doc")
+		})
+	}
+}
+
 func BenchmarkCustomTokenizer(b *testing.B) {}
 
 func BenchmarkDefaultTokenizer(b *testing.B) {}
@@ -236,6 +562,19 @@ func getTestData(t testobj) (fs.FS, []string) {
 	return data, filenames
 }
 
+func getTestBodies(t testobj) [][]byte {
+	data, filenames := getTestData(t)
+	bodies := make([][]byte, len(filenames))
+	for i, filename := range filenames {
+		body, err := fs.ReadFile(data, filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[i] = body
+	}
+	return bodies
+}
+
 func getTestFiles(t testobj) []string {
 	files := make([]string, 0)
 	dir, err := testdata.ReadDir("testdata")
@@ -248,7 +587,7 @@ func getTestFiles(t testobj) []string {
 	return files
 }
 
-func getTestIndex(t testobj) *index {
+func getTestIndex(t testobj) *Index {
 	data, filenames := getTestData(t)
 	ix := NewIndex()
 	for _, filename := range filenames {
@@ -256,7 +595,7 @@ func getTestIndex(t testobj) *index {
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = ix.addDoc(filename, f)
+		_, err = ix.AddDocument(filename, f)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -0,0 +1,285 @@
+package ts
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// SearchTopK returns the k best ranked results of a query.
+//
+// Queries that match any of a list of terms, such as Or, QueryTree or a
+// BoolQuery of Should clauses, are searched with WAND when the scorer is a
+// BoundedScorer. Each term's highest possible score is used to skip the
+// documents that cannot rank above the k-th best result found so far, so
+// documents that only contain frequent terms are rarely scored. Other queries
+// are scored in full but only the best k results are kept and sorted.
+func (ix *Index) SearchTopK(query Query, k int, opts ...SearchOption) []*QueryResult {
+	if k <= 0 {
+		return nil
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	so := newSearchOptions(opts)
+	result := ix.searchTopK(query, k, so)
+	ix.decorate(query, result, so)
+	return result
+}
+
+// searchTopK returns the best k results that the search options accept. WAND
+// is only used when results are sorted by rank. It must be called with the
+// lock held.
+func (ix *Index) searchTopK(query Query, k int, so *searchOptions) []*QueryResult {
+	var (
+		sc  = ix.newScoring(so)
+		top = &topResults{k: k, accept: so.accept, order: ix.newOrdering(so)}
+	)
+	bounded, ok := sc.scorer.(BoundedScorer)
+	if terms, isDisjunction := ix.disjunction(query, 1); ok && isDisjunction && top.order == nil {
+		ix.wand(sc, bounded, terms, top)
+	} else {
+		ix.topK(sc, query, top)
+	}
+	return top.sorted()
+}
+
+// topK scores every document matching a query and keeps the best.
+func (ix *Index) topK(sc *scoring, query Query, top *topResults) {
+	postings := query.search(ix)
+	if len(ix.mem.deleted) > 0 || ix.hasDeletes() {
+		postings = ix.live(postings)
+	}
+	if sc.snapshot {
+		postings = upTo(postings, sc.maxID)
+	}
+	for _, p := range postings {
+		for _, h := range p.hits {
+			sc.addTerm(ix, h.key, h.matches)
+		}
+	}
+	for _, p := range postings {
+		top.push(sc.result(ix, p))
+	}
+}
+
+// weightedTerm is a term of a query and the boost of its matches.
+type weightedTerm struct {
+	key    string
+	weight float64
+}
+
+// disjunction returns the terms of a query that matches documents containing
+// any of its terms and ranks them by the sum of the terms' scores. It returns
+// false for any other query.
+func (ix *Index) disjunction(q Query, weight float64) ([]weightedTerm, bool) {
+	var terms []weightedTerm
+	// addTerm adds the term that text is analyzed to. Text analyzed to
+	// several terms matches documents with all of them, which is not a
+	// disjunction.
+	addTerm := func(field, text string) bool {
+		analyzed := ix.analyzeTerm(field, text)
+		for _, t := range analyzed {
+			terms = append(terms, weightedTerm{fieldKey(field, t), weight})
+		}
+		return len(analyzed) <= 1
+	}
+	switch q := q.(type) {
+	case StringQuery:
+		if !addTerm(DefaultField, string(q)) {
+			return nil, false
+		}
+	case *fieldQuery:
+		if q.keyword {
+			terms = append(terms, weightedTerm{fieldKey(q.field, q.text), weight})
+		} else if !addTerm(q.field, q.text) {
+			return nil, false
+		}
+	case *anyFieldQuery:
+		for field := range ix.fields {
+			if _, ok := q.exclude[field]; !ok && !addTerm(field, q.text) {
+				return nil, false
+			}
+		}
+	case *unionQuery:
+		for _, t := range q.queries {
+			if !addTerm(DefaultField, t) {
+				return nil, false
+			}
+		}
+	case *boostQuery:
+		return ix.disjunction(q.query, weight*q.factor)
+	case *queryTree:
+		return ix.disjunctions([]Query{q.left, q.right}, weight)
+	case *BoolQuery:
+		if len(q.Must)+len(q.Filter)+len(q.MustNot) > 0 || q.MinimumShouldMatch > 1 || q.MinimumShouldMatch < 0 {
+			return nil, false
+		}
+		return ix.disjunctions(q.Should, weight)
+	default:
+		return nil, false
+	}
+	return terms, true
+}
+
+func (ix *Index) disjunctions(queries []Query, weight float64) ([]weightedTerm, bool) {
+	var terms []weightedTerm
+	for _, q := range queries {
+		t, ok := ix.disjunction(q, weight)
+		if !ok {
+			return nil, false
+		}
+		terms = append(terms, t...)
+	}
+	return terms, true
+}
+
+// cursor iterates over the postings of a term.
+type cursor struct {
+	term     weightedTerm
+	postings []*posting
+	i        int
+	// Highest score the term can add to a document
+	bound float64
+}
+
+func (c *cursor) done() bool { return c.i >= len(c.postings) }
+
+func (c *cursor) doc() DocID { return c.postings[c.i].ID }
+
+// wand finds the best documents containing any of a list of terms with the
+// weak-AND algorithm. The cursors are kept ordered by their current document.
+// The pivot is the first cursor at which the sum of the bounds of the cursors
+// up to it reaches the rank of the worst kept result. No document before the pivot's
+// can do so, which lets the cursors before the pivot skip to it.
+func (ix *Index) wand(sc *scoring, bs BoundedScorer, terms []weightedTerm, top *topResults) {
+	cursors := make([]*cursor, 0, len(terms))
+	for _, t := range terms {
+		postings := ix.postings(t.key)
+		if len(postings) == 0 {
+			continue
+		}
+		df := sc.addTerm(ix, t.key, nil)
+		if df == 0 {
+			continue
+		}
+		cursors = append(cursors, &cursor{term: t, postings: postings})
+	}
+	for _, c := range cursors {
+		stats := sc.termStats()
+		stats.Freq = ix.maxFreq(c.term.key)
+		stats.DocFreq = sc.docFreqs[c.term.key]
+		c.bound = bs.MaxScore(&stats) * c.term.weight
+	}
+	for {
+		active := cursors[:0]
+		for _, c := range cursors {
+			if !c.done() {
+				active = append(active, c)
+			}
+		}
+		if cursors = active; len(cursors) == 0 {
+			return
+		}
+		sortCursors(cursors)
+		var (
+			bound     float64
+			threshold = top.threshold()
+			pivot     = -1
+		)
+		for i, c := range cursors {
+			if bound += c.bound; bound >= threshold {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			return
+		}
+		id := cursors[pivot].doc()
+		if cursors[0].doc() != id {
+			for _, c := range cursors[:pivot] {
+				c.i = seek(c.postings, c.i, id)
+			}
+			continue
+		}
+		p := &posting{ID: id}
+		for _, c := range cursors {
+			if c.doc() != id {
+				break
+			}
+			cp := c.postings[c.i]
+			p.Pos = append(p.Pos, cp.Pos...)
+			p.hits = append(p.hits, hit{key: c.term.key, freq: len(cp.Pos), weight: c.term.weight})
+			c.i++
+		}
+		if !ix.isDeleted(id) && (!sc.snapshot || id <= sc.maxID) {
+			top.push(sc.result(ix, p))
+		}
+	}
+}
+
+// sortCursors sorts cursors by their current document. There are few
+// cursors and they are mostly sorted so an insertion sort is used.
+func sortCursors(cursors []*cursor) {
+	for i := 1; i < len(cursors); i++ {
+		for j := i; j > 0 && cursors[j].doc() < cursors[j-1].doc(); j-- {
+			cursors[j], cursors[j-1] = cursors[j-1], cursors[j]
+		}
+	}
+}
+
+// topResults keeps the best k results in a heap with the worst result on top.
+type topResults struct {
+	k       int
+	results []*QueryResult
+	// Results that accept returns false for are not kept, nil keeps every
+	// result.
+	accept func(*QueryResult) bool
+	// Order of the results, nil to order them by rank
+	order *ordering
+}
+
+func (t *topResults) Len() int { return len(t.results) }
+
+func (t *topResults) Less(i, j int) bool { return t.order.worse(t.results[i], t.results[j]) }
+
+func (t *topResults) Swap(i, j int) { t.results[i], t.results[j] = t.results[j], t.results[i] }
+
+func (t *topResults) Push(x interface{}) { t.results = append(t.results, x.(*QueryResult)) }
+
+func (t *topResults) Pop() interface{} {
+	r := t.results[len(t.results)-1]
+	t.results = t.results[:len(t.results)-1]
+	return r
+}
+
+// push adds a result if it is better than the worst kept result.
+func (t *topResults) push(r *QueryResult) {
+	t.order.prepare(r)
+	if t.accept != nil && !t.accept(r) {
+		return
+	}
+	if len(t.results) < t.k {
+		heap.Push(t, r)
+		return
+	}
+	if t.order.worse(t.results[0], r) {
+		t.results[0] = r
+		heap.Fix(t, 0)
+	}
+}
+
+// threshold returns the rank that a document must reach to be kept, -1
+// while fewer than k results have been found. It is only meaningful when
+// results are ordered by rank.
+func (t *topResults) threshold() float64 {
+	if len(t.results) < t.k {
+		return -1
+	}
+	return t.results[0].Rank
+}
+
+// sorted returns the kept results from best to worst.
+func (t *topResults) sorted() []*QueryResult {
+	sort.Slice(t.results, func(i, j int) bool { return t.order.worse(t.results[j], t.results[i]) })
+	return t.results
+}
@@ -0,0 +1,115 @@
+package ts
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestSearchTopK(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+	ix := NewIndex(WithFlushThreshold(50))
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		_, err := ix.AddDocument(fmt.Sprintf("doc%d", i), strings.NewReader(zipfText(r, 5+r.Intn(60))))
+		is.NoErr(err)
+		if i%7 == 3 {
+			is.NoErr(ix.Delete(DocID(i - 1)))
+		}
+	}
+	queries := []Query{
+		StringQuery("w0"),
+		StringQuery("w42"),
+		Or("w0", "w1", "w2"),
+		Or("w3", "w150", "missing"),
+		QueryTree(Boost(StringQuery("w5"), 3), StringQuery("w0")),
+		&BoolQuery{Should: []Query{StringQuery("w7"), Boost(Or("w1", "w90"), 0.5)}, MinimumShouldMatch: 1},
+		AnyFieldQuery("w2"),
+		// Queries that are not disjunctions of terms are scored in full.
+		And(StringQuery("w0"), StringQuery("w1")),
+		&BoolQuery{Should: []Query{StringQuery("w0"), StringQuery("w1"), StringQuery("w2")}, MinimumShouldMatch: 2},
+		PhraseQuery(DefaultField, "w0 w1"),
+	}
+	for _, s := range []Scorer{NewBM25(), TFIDF{}, VectorSpace{}, constScorer{}} {
+		for _, q := range queries {
+			all := ix.Search(q, ScoreWith(s))
+			for _, k := range []int{1, 10, 1000} {
+				top := ix.SearchTopK(q, k, ScoreWith(s))
+				want := k
+				if len(all) < k {
+					want = len(all)
+				}
+				if len(top) != want {
+					t.Fatalf("%T %s k=%d: got %d results, want %d", s, q, k, len(top), want)
+				}
+				for i, r := range top {
+					if r.Rank != all[i].Rank {
+						t.Fatalf("%T %s k=%d: result %d has rank %g, want %g", s, q, k, i, r.Rank, all[i].Rank)
+					}
+					if i > 0 && r.Rank == top[i-1].Rank && r.DocumentID < top[i-1].DocumentID {
+						t.Fatalf("%T %s k=%d: ties are not ordered by ID", s, q, k)
+					}
+				}
+			}
+		}
+	}
+	is.Equal(len(ix.SearchTopK(StringQuery("w0"), 0)), 0)
+	res := ix.SearchTopK(StringQuery("w3"), 2, Explain())
+	is.Equal(res[0].Explanation.Value, res[0].Rank)
+}
+
+// constScorer is a Scorer that cannot bound its scores.
+type constScorer struct{}
+
+func (constScorer) Score(s *TermStats) float64 { return float64(s.Freq) }
+
+// zipfText returns n words following a Zipf distribution so that a few words
+// are found in nearly every document.
+func zipfText(r *rand.Rand, n int) string {
+	z := rand.NewZipf(r, 1.2, 1, 1000)
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", z.Uint64())
+	}
+	return strings.Join(words, " ")
+}
+
+func benchmarkIndex(b *testing.B) *Index {
+	b.Helper()
+	ix := NewIndex()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		if _, err := ix.AddDocument(fmt.Sprintf("doc%d", i), strings.NewReader(zipfText(r, 100))); err != nil {
+			b.Fatal(err)
+		}
+	}
+	ix.Compact()
+	return ix
+}
+
+// Frequent terms are found in most documents while the rare term is found in
+// a few, so WAND can skip the documents that only hold frequent terms.
+var topKQuery = Or("w0", "w1", "w2", "w500")
+
+func BenchmarkSearchFrequentTerms(b *testing.B) {
+	ix := benchmarkIndex(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := ix.Search(topKQuery)
+		_ = res[:10]
+	}
+}
+
+func BenchmarkSearchTopKFrequentTerms(b *testing.B) {
+	ix := benchmarkIndex(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ix.SearchTopK(topKQuery, 10)
+	}
+}